@@ -0,0 +1,308 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// キャラクターの当たり判定半径 (描画半径と同じ)
+const ActorRadius = float64(TileSize) / 3
+
+// Actor は迷路上を移動するキャラクターの共通部分。
+// プレイヤー・ゴーストのほか、今後追加するエンティティもこれを埋め込んで使う。
+type Actor struct {
+	X           float64
+	Y           float64
+	PrevX       float64 // 直前のステップ開始時の座標 (描画の補間用)
+	PrevY       float64
+	DirX        float64
+	DirY        float64
+	Speed       float64 // タイル/秒
+	CanUseDoors bool
+	viaX        float64 // このステップの途中で向きを変えた点
+	viaY        float64
+	hasVia      bool
+}
+
+func (a *Actor) Tile() Point {
+	return Point{X: int(a.X / TileSize), Y: int(a.Y / TileSize)}
+}
+
+func (a *Actor) TileCenter() (float64, float64) {
+	tile := a.Tile()
+	return float64(tile.X*TileSize + TileSize/2), float64(tile.Y*TileSize + TileSize/2)
+}
+
+func (a *Actor) SnapToTileCenter() {
+	a.X, a.Y = a.TileCenter()
+}
+
+// CenterAhead は (dirX, dirY) 方向に見たタイルの中心までの距離を返す。中心を過ぎていれば負。
+func (a *Actor) CenterAhead(dirX, dirY float64) float64 {
+	centerX, centerY := a.TileCenter()
+	return (centerX-a.X)*dirX + (centerY-a.Y)*dirY
+}
+
+// StepDistance は dt 秒で進むピクセル数。
+func (a *Actor) StepDistance(dt float64) float64 {
+	return a.Speed * TileSize * dt
+}
+
+// BeginStep はステップ開始時の座標を記録する。各ステップの最初に呼ぶこと。
+func (a *Actor) BeginStep() {
+	a.PrevX = a.X
+	a.PrevY = a.Y
+	a.hasVia = false
+}
+
+// turnHere はこのステップの途中、今の座標で向きを変えたことを記録する。
+// ステップの中の位置は、ステップの始めからこの点を通って今の座標まで同じ速さで進んだとみなす。
+func (a *Actor) turnHere() {
+	a.viaX, a.viaY, a.hasVia = a.X, a.Y, true
+}
+
+// RenderPosition は直前のステップと現在の座標を alpha で補間した描画位置を返す。
+func (a *Actor) RenderPosition(alpha float64) (float64, float64) {
+	// トンネルでワープした直後は補間すると画面を横切ってしまう
+	if a.warped() {
+		return a.X, a.Y
+	}
+	return a.positionAt(alpha)
+}
+
+// warped はこのステップでトンネルを通って反対側に出たかどうかを返す。
+func (a *Actor) warped() bool {
+	return abs(a.X-a.PrevX) > TileSize || abs(a.Y-a.PrevY) > TileSize
+}
+
+// positionAt はステップの始めを 0、終わりを 1 とした割合 s の時点の座標を返す。
+// ステップの中では向きを変えた点を通って、同じ速さで進んだとみなす。
+func (a *Actor) positionAt(s float64) (float64, float64) {
+	if !a.hasVia {
+		return lerp(a.PrevX, a.X, s), lerp(a.PrevY, a.Y, s)
+	}
+	turn := a.turnedAt()
+	if s <= turn {
+		return lerp(a.PrevX, a.viaX, s/turn), lerp(a.PrevY, a.viaY, s/turn)
+	}
+	u := (s - turn) / (1 - turn)
+	return lerp(a.viaX, a.X, u), lerp(a.viaY, a.Y, u)
+}
+
+// turnedAt はこのステップで向きを変えた時点を、ステップの始めを 0、終わりを 1 とした割合で返す。変えていなければ 0。
+func (a *Actor) turnedAt() float64 {
+	if !a.hasVia {
+		return 0
+	}
+	before := math.Hypot(a.viaX-a.PrevX, a.viaY-a.PrevY)
+	after := math.Hypot(a.X-a.viaX, a.Y-a.viaY)
+	if before+after == 0 {
+		return 0
+	}
+	return before / (before + after)
+}
+
+func lerp(from, to, s float64) float64 {
+	return from + (to-from)*s
+}
+
+// ContactTime はこのステップで a と b が最初に触れた時点を、ステップの始めを 0、終わりを 1 とした割合で返す。
+// 触れていなければ false を返す。ステップの終わりだけで判定すると、刻みが粗いほど触れたのに気づくのが遅れ、
+// その間に食べたドットなどとの前後が刻みの細かさで変わってしまう。
+func (a *Actor) ContactTime(b *Actor) (float64, bool) {
+	const reach = 2 * ActorRadius
+	if a.warped() || b.warped() {
+		dx, dy := a.X-b.X, a.Y-b.Y
+		return 1, dx*dx+dy*dy < reach*reach
+	}
+	// 向きを変えた時点で区切ると、区切りの中ではどちらもまっすぐ進む
+	cuts := []float64{0, a.turnedAt(), b.turnedAt(), 1}
+	slices.Sort(cuts)
+	for i := range len(cuts) - 1 {
+		from, to := cuts[i], cuts[i+1]
+		if to <= from {
+			continue
+		}
+		ax, ay := a.positionAt(from)
+		bx, by := b.positionAt(from)
+		ex, ey := a.positionAt(to)
+		fx, fy := b.positionAt(to)
+		r0x, r0y := ax-bx, ay-by
+		if u, ok := firstTouch(r0x, r0y, (ex-fx)-r0x, (ey-fy)-r0y, reach); ok {
+			return from + u*(to-from), true
+		}
+	}
+	return 0, false
+}
+
+// firstTouch は相対位置 r(u) = r0 + u*d が半径 reach の円に入る最初の u (0 以上 1 未満) を返す。
+func firstTouch(r0x, r0y, dx, dy, reach float64) (float64, bool) {
+	c := r0x*r0x + r0y*r0y - reach*reach
+	if c < 0 {
+		return 0, true
+	}
+	qa := dx*dx + dy*dy
+	qb := 2 * (r0x*dx + r0y*dy)
+	disc := qb*qb - 4*qa*c
+	if qa == 0 || disc < 0 {
+		return 0, false
+	}
+	u := (-qb - math.Sqrt(disc)) / (2 * qa)
+	return u, u >= 0 && u < 1
+}
+
+// EnteredTileAt はこのステップで今のタイルに入った時点を、ステップの始めを 0、終わりを 1 とした割合で返す。
+// ステップの前から同じタイルにいれば 0 を返す。
+func (a *Actor) EnteredTileAt() float64 {
+	prev := Point{X: int(a.PrevX / TileSize), Y: int(a.PrevY / TileSize)}
+	tile := a.Tile()
+	if tile == prev || a.warped() {
+		return 0
+	}
+	// 向きを変えた点がもう今のタイルなら、そこまでの区間で入った
+	if a.hasVia {
+		turn := a.turnedAt()
+		if (Point{X: int(a.viaX / TileSize), Y: int(a.viaY / TileSize)}) == tile {
+			return turn * crossedAt(prev, tile, a.PrevX, a.PrevY, a.viaX, a.viaY)
+		}
+		return turn + (1-turn)*crossedAt(prev, tile, a.viaX, a.viaY, a.X, a.Y)
+	}
+	return crossedAt(prev, tile, a.PrevX, a.PrevY, a.X, a.Y)
+}
+
+// crossedAt は (x0, y0) から (x1, y1) までまっすぐ進んで、タイル from から隣の to へ入った時点を 0 から 1 の割合で返す。
+func crossedAt(from, to Point, x0, y0, x1, y1 float64) float64 {
+	if to.X != from.X {
+		edge := float64(max(to.X, from.X) * TileSize)
+		return (edge - x0) / (x1 - x0)
+	}
+	edge := float64(max(to.Y, from.Y) * TileSize)
+	return (edge - y0) / (y1 - y0)
+}
+
+// Move は (dirX, dirY) 方向に dt 秒分移動する。壁に当たる場合は移動せず false を返す。
+// 進行方向と直交する軸はタイル中心へ寄せるので、曲がり角で引っかかりにくい。
+// 進む先のタイルが壁ならタイルの中心で止まるので、刻みの細かさで止まる位置は変わらない。
+func (a *Actor) Move(dirX, dirY float64, maze [][]int, dt float64) bool {
+	step := a.StepDistance(dt)
+	newX := a.X + dirX*step
+	newY := a.Y + dirY*step
+
+	centerX, centerY := a.TileCenter()
+	if dirX != 0 && dirY == 0 {
+		newY = approach(newY, centerY, step)
+	}
+	if dirY != 0 && dirX == 0 {
+		newX = approach(newX, centerX, step)
+	}
+	if ahead := a.CenterAhead(dirX, dirY); ahead >= 0 && ahead < step && a.IsColliding(centerX+dirX*TileSize/2, centerY+dirY*TileSize/2, maze) {
+		if dirX != 0 {
+			newX = centerX
+		}
+		if dirY != 0 {
+			newY = centerY
+		}
+		if newX == a.X && newY == a.Y {
+			return false
+		}
+	}
+
+	if a.IsColliding(newX, newY, maze) {
+		return false
+	}
+
+	a.X = newX
+	a.Y = newY
+	a.wrapTunnel(maze)
+	return true
+}
+
+func approach(value, target, maxDelta float64) float64 {
+	if abs(target-value) <= maxDelta {
+		return target
+	}
+	if value < target {
+		return value + maxDelta
+	}
+	return value - maxDelta
+}
+
+// wrapTunnel はトンネルから迷路の外に出たキャラクターを反対側へ移す。
+func (a *Actor) wrapTunnel(maze [][]int) {
+	width := float64(len(maze[0]) * TileSize)
+	height := float64(len(maze) * TileSize)
+	if a.X < 0 {
+		a.X += width
+	} else if a.X >= width {
+		a.X -= width
+	}
+	if a.Y < 0 {
+		a.Y += height
+	} else if a.Y >= height {
+		a.Y -= height
+	}
+}
+
+func (a *Actor) blocks(tile int) bool {
+	return tile == TileWall || (tile == TileDoor && !a.CanUseDoors)
+}
+
+// collisionPoint は当たり判定に使うピクセル座標。
+type collisionPoint struct{ px, py float64 }
+
+// checkPoints は (x, y) に置いたときの当たり判定の四隅を返す。
+func checkPoints(x, y float64) [4]collisionPoint {
+	// キャラクターの円の境界4点をチェック
+	return [4]collisionPoint{
+		{x - ActorRadius, y - ActorRadius}, // 左上
+		{x + ActorRadius, y - ActorRadius}, // 右上
+		{x - ActorRadius, y + ActorRadius}, // 左下
+		{x + ActorRadius, y + ActorRadius}, // 右下
+	}
+}
+
+// IsColliding は (x, y) に置いたときに当たり判定の四隅が壁にかかるかを返す。
+func (a *Actor) IsColliding(x, y float64, maze [][]int) bool {
+	for _, point := range checkPoints(x, y) {
+		tileX, tileY, ok := wrapTile(point.px, point.py, maze)
+		if !ok {
+			return true
+		}
+
+		if a.blocks(maze[tileY][tileX]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wrapTile はピクセル座標をタイル座標に変換する。
+// 迷路の外側は、同じ行 (列) の端がトンネルであれば反対側のタイルとして扱う。
+func wrapTile(px, py float64, maze [][]int) (int, int, bool) {
+	height := len(maze)
+	width := len(maze[0])
+	tileX := floorDiv(px, TileSize)
+	tileY := floorDiv(py, TileSize)
+
+	if tileY >= 0 && tileY < height && (tileX < 0 || tileX >= width) {
+		if maze[tileY][0] != TileTunnel && maze[tileY][width-1] != TileTunnel {
+			return 0, 0, false
+		}
+		tileX = (tileX + width) % width
+	}
+	if tileX >= 0 && tileX < width && (tileY < 0 || tileY >= height) {
+		if maze[0][tileX] != TileTunnel && maze[height-1][tileX] != TileTunnel {
+			return 0, 0, false
+		}
+		tileY = (tileY + height) % height
+	}
+	if tileY < 0 || tileY >= height || tileX < 0 || tileX >= width {
+		return 0, 0, false
+	}
+	return tileX, tileY, true
+}
+
+func floorDiv(v float64, size int) int {
+	return int(math.Floor(v / float64(size)))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	StartingLives = 3
+	readyDuration = 2 * time.Second // 交代のときに「PLAYER n」を表示する時間
+)
+
+// playerSlot は交代プレイのプレイヤーひとり分の状態。
+// 迷路のドットやスコア・面数は game がそのまま持っているので、交代しても失われない。
+type playerSlot struct {
+	game  *GameScene
+	lives int
+}
+
+// AlternatingScene はアーケードの2人交代プレイ。ミスするたびに残機のあるもう一人へ交代する。
+type AlternatingScene struct {
+	maze       *Maze
+	config     GameConfig
+	slots      []*playerSlot
+	current    int
+	readyUntil time.Time // この時刻まで交代の表示を出してゲームを止める
+	paused     bool      // 交代の表示を出したあと、まだゲームを再開していない
+	finished   bool      // 全員の残機がなくなった
+	games      int       // これまでに始めた面の数。面ごとに乱数のシードを変える
+	exit       func() Scene
+}
+
+func NewAlternatingScene(maze *Maze, config GameConfig, players int, exit func() Scene) *AlternatingScene {
+	as := &AlternatingScene{maze: maze, config: config, exit: exit}
+	for i := 0; i < players; i++ {
+		slot := &playerSlot{lives: StartingLives}
+		as.slots = append(as.slots, slot)
+		as.startLevel(slot, 1, 0)
+	}
+	as.showReady()
+	return as
+}
+
+// startLevel は slot のプレイヤーの新しい面を始める。
+func (as *AlternatingScene) startLevel(slot *playerSlot, level, score int) {
+	config := as.config
+	config.Seed += int64(as.games)
+	as.games++
+	gs := NewGameScene(as.maze, config)
+	gs.SetLevel(level)
+	gs.Score = score
+	gs.exit = as.exit
+	gs.hud = as.drawHUD
+	if gs.telemetry != nil {
+		// ミスのたびに GameOver になるが、同じ面を交代で続けるので記録は残機がなくなるまで閉じない
+		gs.telemetry.continues = true
+	}
+	slot.game = gs
+}
+
+func (as *AlternatingScene) showReady() {
+	as.readyUntil = time.Now().Add(readyDuration)
+	as.paused = true
+}
+
+func (as *AlternatingScene) ready() bool {
+	return time.Now().Before(as.readyUntil)
+}
+
+func (as *AlternatingScene) Update() Scene {
+	if as.finished {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) && !ebiten.IsKeyPressed(ebiten.KeyAlt) && as.exit != nil {
+			return as.exit()
+		}
+		return as
+	}
+	if as.ready() {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEscape) && as.exit != nil {
+			as.abort()
+			return as.exit()
+		}
+		return as
+	}
+
+	slot := as.slots[as.current]
+	gs := slot.game
+	if as.paused {
+		// 交代の表示中に止めていた時間を進めない
+		gs.clock.Reset()
+		as.paused = false
+	}
+	switch next := gs.Update().(type) {
+	case *GameScene:
+		return as
+	case *GameOverScene:
+		slot.lives--
+		if slot.lives == 0 {
+			gs.telemetry.End(OutcomeDeath)
+		}
+		gs.ResetPositions()
+		// 残機は slot で数えているので、ゲームの中では毎回1機からやり直す
+		gs.players[0].Lives = 1
+		as.nextTurn()
+	case *StageClearScene:
+		as.startLevel(slot, gs.level+1, gs.Score)
+		as.showReady()
+	default:
+		// Esc などでゲームを抜けた
+		as.abort()
+		return next
+	}
+	return as
+}
+
+// abort は途中でやめたときに、まだ続いている全員の記録を閉じる。
+func (as *AlternatingScene) abort() {
+	for _, slot := range as.slots {
+		slot.game.telemetry.Abort(OutcomeQuit)
+	}
+}
+
+// nextTurn はミスの後、次に残機のあるプレイヤーへ交代する。誰も残っていなければ終了する。
+func (as *AlternatingScene) nextTurn() {
+	for i := 1; i <= len(as.slots); i++ {
+		next := (as.current + i) % len(as.slots)
+		if as.slots[next].lives > 0 {
+			as.current = next
+			as.showReady()
+			return
+		}
+	}
+	as.finished = true
+}
+
+func (as *AlternatingScene) Draw(screen *ebiten.Image) {
+	as.slots[as.current].game.Draw(screen)
+
+	screenWidth, screenHeight := ScreenSize()
+	centerX := float32(screenWidth) / 2
+	centerY := float32(screenHeight) / 2
+	switch {
+	case as.finished:
+		vector.DrawFilledRect(screen, 0, centerY-30, float32(screenWidth), 60, color.RGBA{A: 200}, false)
+		drawTextCentered(screen, "GAME OVER", centerX, centerY-20, 4, color.RGBA{R: 255, A: 255})
+		drawTextCentered(screen, "PRESS ENTER", centerX, centerY+12, 2, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	case as.ready():
+		vector.DrawFilledRect(screen, 0, centerY-30, float32(screenWidth), 60, color.RGBA{A: 200}, false)
+		drawTextCentered(screen, fmt.Sprintf("PLAYER %d", as.current+1), centerX, centerY-20, 4, ghostColors[2])
+		drawTextCentered(screen, "READY!", centerX, centerY+12, 2, PlayerColor)
+	}
+}
+
+// drawHUD は全員のスコアと残機を表示する。遊んでいるプレイヤーは黄色にする。
+func (as *AlternatingScene) drawHUD(screen *ebiten.Image) {
+	screenWidth, _ := ScreenSize()
+	columnWidth := float32(screenWidth) / float32(len(as.slots))
+	for i, slot := range as.slots {
+		clr := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		if i == as.current && !as.finished {
+			clr = PlayerColor
+		}
+		x := 10 + columnWidth*float32(i)
+		drawText(screen, fmt.Sprintf("%dUP %d", i+1, slot.game.Score), x, 10, 2, clr)
+		for life := 0; life < slot.lives; life++ {
+			vector.DrawFilledCircle(screen, x+5+float32(life)*14, 32, 5, PlayerColor, true)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math/rand"
+)
+
+// ランダム迷路モードで生成する迷路の大きさ
+const (
+	RandomMazeWidth  = 27
+	RandomMazeHeight = 21
+)
+
+// App はシーンをまたいで使う設定と資源をまとめる。
+type App struct {
+	Maze     *Maze  // 通常モードで遊ぶ迷路
+	MazePath string // Maze を読み込んだファイル。組み込みの迷路なら空
+	Config   GameConfig
+	rng      *rand.Rand // ゲームごとのシードと、ランダム迷路のシードを作る
+}
+
+func NewApp(maze *Maze, config GameConfig) *App {
+	return &App{
+		Maze:   maze,
+		Config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+func (a *App) Title() Scene {
+	SetScreenSizeForMaze(a.Maze)
+	return &TitleScene{app: a}
+}
+
+// Editor は通常モードの迷路を編集するエディタを開く。
+func (a *App) Editor() Scene {
+	path := a.MazePath
+	if path == "" {
+		path = "maze.txt"
+	}
+	return NewEditorScene(a, a.Maze, path)
+}
+
+// NewGame は迷路 m で新しいゲームを始める。
+func (a *App) NewGame(m *Maze) Scene {
+	SetScreenSizeForMaze(m)
+	config := a.Config
+	config.Seed = a.rng.Int63()
+	gs := NewGameScene(m, config)
+	gs.allowAssist = true
+	gs.exit = a.Title
+	return gs
+}
+
+// NewTwoPlayerGame は2人交代プレイを始める。
+func (a *App) NewTwoPlayerGame() Scene {
+	SetScreenSizeForMaze(a.Maze)
+	config := a.Config
+	config.Seed = a.rng.Int63()
+	return NewAlternatingScene(a.Maze, config, 2, a.Title)
+}
+
+// NewCoopGame は2人同時プレイを始める。ドットは共有し、スコアと残機はそれぞれが持つ。
+// 1人目は矢印キーと1台目のゲームパッド、2人目は WASD と2台目のゲームパッドで操作する。
+func (a *App) NewCoopGame() Scene {
+	SetScreenSizeForMaze(a.Maze)
+	config := a.Config
+	config.Seed = a.rng.Int63()
+	config.Players = 2
+	config.Lives = StartingLives
+	config.Controllers = []Controller{
+		NewKeyboardController(ArrowKeys, 1),
+		NewKeyboardController(WASDKeys, 2),
+	}
+	gs := NewGameScene(a.Maze, config)
+	gs.exit = a.Title
+	return gs
+}
+
+// NewVersusGame は1人がプレイヤー、もう1人がゴーストを操作する対戦を始める。
+func (a *App) NewVersusGame() Scene {
+	SetScreenSizeForMaze(a.Maze)
+	config := a.Config
+	config.Seed = a.rng.Int63()
+	return NewVersusScene(a.Maze, config, a.Title)
+}
+
+// Demo はアトラクトモードのデモを始める。自動操縦で遊び、キーを押すか決着がつくとタイトルに戻る。
+func (a *App) Demo() Scene {
+	SetScreenSizeForMaze(a.Maze)
+	config := a.Config
+	config.Seed = a.rng.Int63()
+	config.Controllers = []Controller{NewAutopilot()}
+	config.Sound = nil
+	// デモは人のプレイではないので記録しない
+	config.TelemetryDir = ""
+	gs := NewGameScene(a.Maze, config)
+	gs.demo = true
+	gs.exit = a.Title
+	return gs
+}
+
+// NewRandomGame は新しく生成した迷路でゲームを始める。
+func (a *App) NewRandomGame() Scene {
+	m, err := GenerateMaze(MazeGenOptions{
+		Width:   RandomMazeWidth,
+		Height:  RandomMazeHeight,
+		Seed:    a.rng.Int63(),
+		Tunnels: a.rng.Intn(2) == 0,
+	})
+	if err != nil {
+		// 生成に失敗することは想定していないが、念のため通常の迷路で遊べるようにする
+		return a.NewGame(a.Maze)
+	}
+	return a.NewGame(m)
+}
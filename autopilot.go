@@ -0,0 +1,269 @@
+package main
+
+import (
+	"math"
+)
+
+// 自動操縦の調整値
+const (
+	autopilotSafetyMargin  = 0.4  // ゴーストより何秒先に着けるタイルを安全とみなすか
+	autopilotPredictSteps  = 6    // ゴーストの予測経路を何タイル先まで危険とするか
+	autopilotTrapRoom      = 10   // 安全に動けるタイルがこれより少ない方向は袋小路とみなす
+	autopilotDiscount      = 0.9  // 1タイル遠いごとに報酬を割り引く率
+	autopilotFrightenedEnd = 1.0  // 怯え状態の残りがこれ (秒) を切ったゴーストは脅威とみなす
+	autopilotPelletAlarm   = 8    // 脅威のゴーストがこのタイル数以内にいればパワークッキーを優先する
+	autopilotKeepDirection = 0.05 // 向きを頻繁に変えないように、今の向きに少しだけ加点する
+)
+
+// 報酬の大きさ
+const (
+	rewardDot             = 1.0
+	rewardPellet          = 1.0
+	rewardPelletAlarm     = 6.0
+	rewardFrightenedGhost = 10.0
+)
+
+// Autopilot はキーボードと同じ入力でゲームを遊ぶ AI。
+// タイルごとに、ゴーストの位置と予測経路から危険度マップ (各タイルにゴーストが着くまでの時間) を作り、
+// 進む方向ごとに「ゴーストより先に着けるタイル」だけをたどって、ドット・パワークッキー・怯えたゴーストを探す。
+// 安全に動ける範囲が狭い方向は、奥まで行って戻るまでにゴーストが出口をふさげるなら袋小路とみなして避ける。
+type Autopilot struct {
+	paths *Pathfinder
+	tileSteering
+	speed float64 // 操作しているプレイヤーの速さ (タイル/秒)
+	lead  float64 // ゴーストを進めた時刻から方向を決める時刻までの秒数
+
+	ghosts    []ghostView
+	ghostTime []float64 // 脅威のゴーストがそのタイルに着くまでの最短時間 (秒)
+	predicted []bool    // ゴーストがこれから通ると予測されるタイル
+	visited   []int32
+	queue     []Point
+}
+
+func NewAutopilot() *Autopilot {
+	return &Autopilot{}
+}
+
+func (a *Autopilot) Input(gs *GameScene, p *Player, dt float64) PlayerInput {
+	if a.paths == nil {
+		a.paths = NewPathfinder(gs.maze, false)
+	}
+	a.speed = p.Speed
+	// ゴーストを進めた時刻から、プレイヤーが中心に着いて方向を決める時刻まで
+	a.lead = max(0, gs.elapsed-dt-gs.ghostsAt)
+	return a.steer(p, dt, func(tile Point) Point {
+		return a.choose(gs, tile)
+	})
+}
+
+// choose は tile から進む方向を選ぶ。
+func (a *Autopilot) choose(gs *GameScene, tile Point) Point {
+	a.viewGhosts(gs)
+	a.updateDanger(gs, tile)
+
+	best := Point{}
+	bestScore := math.Inf(-1)
+	for _, dir := range Directions {
+		next, ok := a.paths.Step(tile, dir)
+		if !ok {
+			continue
+		}
+		score := a.evaluate(gs, tile, next)
+		if dir == a.dir {
+			score += autopilotKeepDirection
+		}
+		if score > bestScore {
+			best, bestScore = dir, score
+		}
+	}
+	return best
+}
+
+// ghostView は方向を決める時点でのゴーストの見積もり。
+type ghostView struct {
+	tile       Point
+	state      GhostState
+	frightened float64 // 怯え状態の残り秒数
+	speed      float64 // タイル/秒
+}
+
+// viewGhosts は方向を決める時点のゴーストを見積もる。
+// ゴーストはプレイヤーのあとに動くので、ここで見えるのはステップの始めの状態。プレイヤーが中心に着くまでの lead 秒だけ
+// 進めておかないと、刻みの細かさで見えるゴーストが変わる。曲がるのはタイルの中心だけなので、まっすぐ進めればタイルは求まる。
+func (a *Autopilot) viewGhosts(gs *GameScene) {
+	a.ghosts = a.ghosts[:0]
+	for _, ghost := range gs.ghosts {
+		v := ghostView{tile: ghost.Tile(), state: ghost.State, frightened: ghost.FrightenedTimer, speed: ghost.Speed}
+		if v.state == Frightened {
+			v.frightened -= a.lead
+			if v.frightened <= 0 {
+				v.state, v.frightened = Normal, 0
+			}
+		}
+		if moving := a.lead - ghost.releaseTimer; moving > 0 {
+			distance := ghost.StepDistance(moving)
+			if ghost.State == Eaten {
+				distance *= EatenSpeedMultiplier
+				// 巣の中心に着けば元に戻る
+				if ahead := ghost.CenterAhead(ghost.DirX, ghost.DirY); ghost.Tile() == ghost.homeTile() && ahead >= 0 && ahead <= distance {
+					v.state = Normal
+				}
+			}
+			x := ghost.X + ghost.DirX*distance
+			y := ghost.Y + ghost.DirY*distance
+			w, h := gs.ghostPaths.width, gs.ghostPaths.height
+			// トンネルの端からは反対側に出る。壁の手前ではタイルの中心で止まる
+			tile := Point{X: (int(math.Floor(x/TileSize)) + w) % w, Y: (int(math.Floor(y/TileSize)) + h) % h}
+			if gs.ghostPaths.Walkable(tile) {
+				v.tile = tile
+			}
+		}
+		a.ghosts = append(a.ghosts, v)
+	}
+}
+
+// threatening はゴーストがプレイヤーを捕まえうる状態かどうかを返す。
+func (v ghostView) threatening() bool {
+	switch v.state {
+	case Eaten:
+		return false
+	case Frightened:
+		return v.frightened < autopilotFrightenedEnd
+	}
+	return true
+}
+
+// updateDanger は危険度マップを作り直す。player はプレイヤーのいるタイル。
+func (a *Autopilot) updateDanger(gs *GameScene, player Point) {
+	pf := a.paths
+	size := pf.width * pf.height
+	if len(a.ghostTime) != size {
+		a.ghostTime = make([]float64, size)
+		a.predicted = make([]bool, size)
+		a.visited = make([]int32, size)
+	}
+	for i := range a.ghostTime {
+		a.ghostTime[i] = math.Inf(1)
+		a.predicted[i] = false
+	}
+
+	for _, ghost := range a.ghosts {
+		ghostTile := ghost.tile
+		if !ghost.threatening() || !gs.ghostPaths.InBounds(ghostTile) {
+			continue
+		}
+		for i := 0; i < size; i++ {
+			if d := gs.ghostPaths.Distance(ghostTile, pf.point(i)); d >= 0 {
+				a.ghostTime[i] = math.Min(a.ghostTime[i], float64(d)/ghost.speed)
+			}
+		}
+
+		// ゴーストはプレイヤーへの最短経路をたどってくるので、その先のタイルは余裕を多めに見る
+		p := ghostTile
+		for step := 0; step < autopilotPredictSteps; step++ {
+			dir, ok := gs.ghostPaths.NextDirection(p, player)
+			if !ok {
+				break
+			}
+			if p, ok = gs.ghostPaths.Step(p, dir); !ok {
+				break
+			}
+			a.predicted[pf.index(p)] = true
+		}
+	}
+}
+
+// margin はプレイヤーが distance タイル進んでタイル i に着いたとき、ゴーストより何秒早いかを返す。
+func (a *Autopilot) margin(gs *GameScene, i int, distance int32) float64 {
+	margin := a.ghostTime[i] - float64(distance)/a.speed
+	if a.predicted[i] {
+		margin -= autopilotSafetyMargin
+	}
+	return margin
+}
+
+// evaluate は from から next へ進んだときの評価値を返す。
+// from には戻らないものとして next から幅優先でたどり、ゴーストより先に着けるタイルだけを広げる。
+// 見つかった報酬を距離で割り引いた最大値と、動ける広さ (袋小路かどうか) で評価する。
+func (a *Autopilot) evaluate(gs *GameScene, from, next Point) float64 {
+	pf := a.paths
+	ni := pf.index(next)
+	if margin := a.margin(gs, ni, 1); margin < autopilotSafetyMargin {
+		// どの方向も危険なら、少しでもゴーストから遠い方へ逃げる
+		return -1000 + math.Max(margin, -100)
+	}
+
+	threatNear := false
+	for _, ghost := range a.ghosts {
+		if ghost.threatening() && gs.ghostPaths.InBounds(ghost.tile) {
+			if d := gs.ghostPaths.Distance(ghost.tile, from); d >= 0 && d <= autopilotPelletAlarm {
+				threatNear = true
+			}
+		}
+	}
+
+	for i := range a.visited {
+		a.visited[i] = -1
+	}
+	a.visited[pf.index(from)] = 0
+	a.visited[ni] = 1
+	a.queue = append(a.queue[:0], next)
+	best := 0.0
+	room, depth := 0, int32(0)
+	cornered := false // ゴーストのせいで広げられなかったタイルがある
+	for len(a.queue) > 0 {
+		p := a.queue[0]
+		a.queue = a.queue[1:]
+		i := pf.index(p)
+		room++
+		depth = max(depth, a.visited[i])
+		if reward := a.reward(gs, p, a.visited[i], threatNear); reward > 0 {
+			best = math.Max(best, reward*math.Pow(autopilotDiscount, float64(a.visited[i]-1)))
+		}
+		for _, dir := range Directions {
+			q, ok := pf.Step(p, dir)
+			if !ok {
+				continue
+			}
+			j := pf.index(q)
+			if a.visited[j] >= 0 {
+				continue
+			}
+			if a.margin(gs, j, a.visited[i]+1) < autopilotSafetyMargin {
+				cornered = true
+				continue
+			}
+			a.visited[j] = a.visited[i] + 1
+			a.queue = append(a.queue, q)
+		}
+	}
+
+	score := best
+	// ゴーストに出口をふさがれていない行き止まりは、奥まで行って from に戻るより先に脅威のゴーストが from に着けるときだけ避ける
+	trapped := cornered || a.ghostTime[pf.index(from)] < 2*float64(depth)/a.speed+autopilotSafetyMargin
+	if room < autopilotTrapRoom && trapped {
+		score -= 100 - float64(room)
+	}
+	return score
+}
+
+// reward は distance タイル先の p に着いたときに得られるものの価値を返す。
+func (a *Autopilot) reward(gs *GameScene, p Point, distance int32, threatNear bool) float64 {
+	reward := 0.0
+	switch gs.maze[p.Y][p.X] {
+	case TileDot:
+		reward = rewardDot
+	case TilePellet:
+		reward = rewardPellet
+		if threatNear {
+			reward = rewardPelletAlarm
+		}
+	}
+	arrival := float64(distance) / a.speed
+	for _, ghost := range a.ghosts {
+		if ghost.state == Frightened && ghost.tile == p && ghost.frightened > arrival+autopilotFrightenedEnd {
+			reward = math.Max(reward, rewardFrightenedGhost)
+		}
+	}
+	return reward
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+)
+
+// Camera は画面に映すワールド上の範囲 (左上の座標) を管理する。
+// 追従対象がデッドゾーン (画面中央の矩形) の外に出たときだけ動き、動きは指数的に滑らかにする。
+type Camera struct {
+	X              float64
+	Y              float64
+	PrevX          float64
+	PrevY          float64
+	DeadZoneWidth  float64 // ピクセル
+	DeadZoneHeight float64
+	Smoothing      float64 // 大きいほど素早く追いつく (1/秒)
+}
+
+func NewCamera() *Camera {
+	return &Camera{
+		DeadZoneWidth:  TileSize * 4,
+		DeadZoneHeight: TileSize * 3,
+		Smoothing:      8,
+	}
+}
+
+// Follow は (targetX, targetY) を追ってカメラを dt 秒分動かす。
+// カメラはワールドの外を映さないように制限する。
+func (c *Camera) Follow(targetX, targetY, worldW, worldH, viewW, viewH, dt float64) {
+	c.PrevX, c.PrevY = c.X, c.Y
+
+	goalX := followAxis(c.X, targetX, viewW, c.DeadZoneWidth)
+	goalY := followAxis(c.Y, targetY, viewH, c.DeadZoneHeight)
+
+	t := 1 - math.Exp(-c.Smoothing*dt)
+	c.X += (goalX - c.X) * t
+	c.Y += (goalY - c.Y) * t
+	c.X = clampCamera(c.X, worldW, viewW)
+	c.Y = clampCamera(c.Y, worldH, viewH)
+}
+
+// CenterOn はカメラを (targetX, targetY) が中央に来る位置へ即座に移す。
+func (c *Camera) CenterOn(targetX, targetY, worldW, worldH, viewW, viewH float64) {
+	c.X = clampCamera(targetX-viewW/2, worldW, viewW)
+	c.Y = clampCamera(targetY-viewH/2, worldH, viewH)
+	c.PrevX, c.PrevY = c.X, c.Y
+}
+
+// RenderPosition は直前の位置と現在の位置を alpha で補間した描画用のカメラ位置を返す。
+func (c *Camera) RenderPosition(alpha float64) (float64, float64) {
+	return math.Round(c.PrevX + (c.X-c.PrevX)*alpha), math.Round(c.PrevY + (c.Y-c.PrevY)*alpha)
+}
+
+func followAxis(camera, target, view, deadZone float64) float64 {
+	low := camera + (view-deadZone)/2
+	high := low + deadZone
+	switch {
+	case target < low:
+		return camera - (low - target)
+	case target > high:
+		return camera + (target - high)
+	}
+	return camera
+}
+
+func clampCamera(pos, world, view float64) float64 {
+	if world <= view {
+		// ワールドが画面より小さい軸は中央に寄せる
+		return (world - view) / 2
+	}
+	return math.Max(0, math.Min(pos, world-view))
+}
+
+// isOnScreen は中心 (x, y)・半径 radius のものが、(cameraX, cameraY) を左上とする画面に入るかどうかを返す。
+func isOnScreen(x, y, radius, cameraX, cameraY, viewW, viewH float64) bool {
+	return x+radius >= cameraX && x-radius <= cameraX+viewW && y+radius >= cameraY && y-radius <= cameraY+viewH
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// サブコマンド。`PackManClaude <command> [flags]` の形で呼び出す
+var commands = map[string]func(args []string) error{
+	"env":      runEnv,
+	"genmaze":  runGenMaze,
+	"heatmap":  runHeatmap,
+	"netplay":  runNetplay,
+	"serve":    runServe,
+	"sim":      runSim,
+	"validate": runValidate,
+}
+
+// runCommand は args[0] がサブコマンドなら実行して true を返す。
+// エラーの場合はメッセージを表示して終了コード 1 で終わる。
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+	if err := command(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	return true
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// PlayerInput はそのステップで押されている方向。複数同時に押してもよい。
+type PlayerInput struct {
+	Up    bool
+	Down  bool
+	Left  bool
+	Right bool
+}
+
+// InputToward は dir の方向だけを押した入力を返す。
+func InputToward(dir Point) PlayerInput {
+	return PlayerInput{Up: dir.Y < 0, Down: dir.Y > 0, Left: dir.X < 0, Right: dir.X > 0}
+}
+
+// Controller はプレイヤーの操作を決める。シミュレーションの1ステップごとに、操作するプレイヤー p ごとに呼ばれる。
+type Controller interface {
+	Input(gs *GameScene, p *Player, dt float64) PlayerInput
+}
+
+// GhostController は人が操作するゴーストの入力を決める。ゴーストは分かれ道でしか曲がれず、引き返せない。
+type GhostController interface {
+	GhostInput(gs *GameScene, g *Ghost, dt float64) PlayerInput
+}
+
+// KeyBindings は上下左右に割り当てるキー。
+type KeyBindings struct {
+	Up, Down, Left, Right ebiten.Key
+}
+
+var (
+	ArrowKeys = KeyBindings{Up: ebiten.KeyArrowUp, Down: ebiten.KeyArrowDown, Left: ebiten.KeyArrowLeft, Right: ebiten.KeyArrowRight}
+	WASDKeys  = KeyBindings{Up: ebiten.KeyW, Down: ebiten.KeyS, Left: ebiten.KeyA, Right: ebiten.KeyD}
+
+	// DefaultKeyBindings は n 人目のプレイヤーに割り当てるキー。同時プレイでは1台のキーボードを分け合う。
+	DefaultKeyBindings = []KeyBindings{ArrowKeys, WASDKeys}
+)
+
+// gamepadStickThreshold はスティックをこれ以上倒したら方向キーを押したとみなす値。
+const gamepadStickThreshold = 0.5
+
+// KeyboardController はキーボードとゲームパッドで操作する。
+type KeyboardController struct {
+	Keys    KeyBindings
+	Gamepad int // 接続されている何台目のゲームパッドも使うか (1 から数える)。0 なら使わない
+}
+
+func NewKeyboardController(keys KeyBindings, gamepad int) KeyboardController {
+	return KeyboardController{Keys: keys, Gamepad: gamepad}
+}
+
+func (c KeyboardController) Input(gs *GameScene, p *Player, dt float64) PlayerInput {
+	return c.read()
+}
+
+func (c KeyboardController) GhostInput(gs *GameScene, g *Ghost, dt float64) PlayerInput {
+	return c.read()
+}
+
+func (c KeyboardController) read() PlayerInput {
+	input := PlayerInput{
+		Up:    ebiten.IsKeyPressed(c.Keys.Up),
+		Down:  ebiten.IsKeyPressed(c.Keys.Down),
+		Left:  ebiten.IsKeyPressed(c.Keys.Left),
+		Right: ebiten.IsKeyPressed(c.Keys.Right),
+	}
+	if c.Gamepad <= 0 {
+		return input
+	}
+	ids := ebiten.AppendGamepadIDs(nil)
+	if c.Gamepad > len(ids) || !ebiten.IsStandardGamepadLayoutAvailable(ids[c.Gamepad-1]) {
+		return input
+	}
+	id := ids[c.Gamepad-1]
+	x := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+	y := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+	input.Up = input.Up || y < -gamepadStickThreshold || ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftTop)
+	input.Down = input.Down || y > gamepadStickThreshold || ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftBottom)
+	input.Left = input.Left || x < -gamepadStickThreshold || ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftLeft)
+	input.Right = input.Right || x > gamepadStickThreshold || ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftRight)
+	return input
+}
+
+// tileSteering はタイルごとに進む方向を決めるコントローラの共通部分。
+// 曲がれるのはタイルの中心付近だけなので、中心に来るまでは今の方向に進み続ける。
+// GameScene はプレイヤーを中心で止めてから入力を聞くので、方向は中心に着いた時点の状態で決まる。
+type tileSteering struct {
+	dir     Point
+	decided Point // 最後に方向を決めたタイル
+	started bool
+}
+
+// centerSteered はタイルの中心で方向を決めるコントローラ。
+type centerSteered interface {
+	steersAtCenter()
+}
+
+func (s *tileSteering) steersAtCenter() {}
+
+func (s *tileSteering) steer(p *Player, dt float64, choose func(tile Point) Point) PlayerInput {
+	tile := p.Tile()
+	centerX, centerY := p.TileCenter()
+	step := p.StepDistance(dt)
+	if !s.started {
+		// 途中から操作を引き継いだときは、中心に着くまで今の向きのまま進む
+		s.dir = Point{X: int(p.DirX), Y: int(p.DirY)}
+	}
+	if abs(p.X-centerX) <= step && abs(p.Y-centerY) <= step && (!s.started || tile != s.decided) {
+		s.dir = choose(tile)
+		s.decided = tile
+		s.started = true
+	}
+	return InputToward(s.dir)
+}
+
+// RandomController は分かれ道でランダムに進む方向を選ぶ。行き止まり以外では引き返さない。
+type RandomController struct {
+	rng   *rand.Rand
+	paths *Pathfinder
+	tileSteering
+}
+
+func NewRandomController(seed int64) *RandomController {
+	return &RandomController{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (c *RandomController) Input(gs *GameScene, p *Player, dt float64) PlayerInput {
+	if c.paths == nil {
+		c.paths = NewPathfinder(gs.maze, false)
+	}
+	pf := c.paths
+	return c.steer(p, dt, func(tile Point) Point {
+		var options []Point
+		reverse := Point{X: -c.dir.X, Y: -c.dir.Y}
+		for _, dir := range Directions {
+			if _, ok := pf.Step(tile, dir); ok && dir != reverse {
+				options = append(options, dir)
+			}
+		}
+		if len(options) == 0 {
+			return reverse
+		}
+		return options[c.rng.Intn(len(options))]
+	})
+}
+
+// GreedyController はゴーストを気にせず、いちばん近いドットへ向かう。
+type GreedyController struct {
+	paths *Pathfinder
+	tileSteering
+}
+
+func (c *GreedyController) Input(gs *GameScene, p *Player, dt float64) PlayerInput {
+	if c.paths == nil {
+		c.paths = NewPathfinder(gs.maze, false)
+	}
+	pf := c.paths
+	return c.steer(p, dt, func(tile Point) Point {
+		dir, ok := firstStepToward(pf, tile, func(q Point) bool {
+			t := gs.maze[q.Y][q.X]
+			return t == TileDot || t == TilePellet
+		})
+		if !ok {
+			return Point{}
+		}
+		return dir
+	})
+}
+
+// firstStepToward は from から幅優先で探索し、goal を満たす最も近いタイルへ向かう最初の1歩の方向を返す。
+func firstStepToward(pf *Pathfinder, from Point, goal func(Point) bool) (Point, bool) {
+	if !pf.Walkable(from) {
+		return Point{}, false
+	}
+	firstDir := make([]int8, pf.width*pf.height)
+	for i := range firstDir {
+		firstDir[i] = -1
+	}
+	firstDir[pf.index(from)] = int8(len(Directions))
+	queue := []Point{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for d, dir := range Directions {
+			next, ok := pf.Step(current, dir)
+			if !ok || firstDir[pf.index(next)] != -1 {
+				continue
+			}
+			first := firstDir[pf.index(current)]
+			if current == from {
+				first = int8(d)
+			}
+			firstDir[pf.index(next)] = first
+			if goal(next) {
+				return Directions[first], true
+			}
+			queue = append(queue, next)
+		}
+	}
+	return Point{}, false
+}
+
+// ScriptController はスクリプトに書かれた入力を順に再生する。最後まで再生したら止まる。
+//
+// スクリプトは1行に「方向 秒数」を書く。方向は up, down, left, right, none のいずれか。
+// # で始まる行と空行は無視する。
+type ScriptController struct {
+	steps []scriptStep
+	index int
+	timer float64
+}
+
+type scriptStep struct {
+	input    PlayerInput
+	duration float64
+}
+
+var scriptDirections = map[string]Point{
+	"up":    {X: 0, Y: -1},
+	"down":  {X: 0, Y: 1},
+	"left":  {X: -1, Y: 0},
+	"right": {X: 1, Y: 0},
+	"none":  {},
+}
+
+func loadScript(path string) ([]scriptStep, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var steps []scriptStep
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"direction seconds\"", path, line)
+		}
+		dir, ok := scriptDirections[strings.ToLower(fields[0])]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: unknown direction %q", path, line, fields[0])
+		}
+		duration, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid duration %q", path, line, fields[1])
+		}
+		steps = append(steps, scriptStep{input: InputToward(dir), duration: duration})
+	}
+	return steps, scanner.Err()
+}
+
+// NewScriptController はスクリプトを再生するコントローラを作る。steps は共有してよい。
+func NewScriptController(steps []scriptStep) *ScriptController {
+	return &ScriptController{steps: steps}
+}
+
+func (c *ScriptController) Input(gs *GameScene, p *Player, dt float64) PlayerInput {
+	for c.index < len(c.steps) && c.timer >= c.steps[c.index].duration {
+		c.timer -= c.steps[c.index].duration
+		c.index++
+	}
+	if c.index >= len(c.steps) {
+		return PlayerInput{}
+	}
+	c.timer += dt
+	return c.steps[c.index].input
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// debugOverlay はデバッグ表示を出すかどうか。F3 でどの画面からでも切り替えられる。
+var debugOverlay bool
+
+// GhostDecision はゴーストが最後に進む方向を決めた理由。
+type GhostDecision int
+
+const (
+	DecisionNone   GhostDecision = iota
+	DecisionChase                // いちばん近いプレイヤーへの歩数が減る方向
+	DecisionFlee                 // いじけ中。いちばん近いプレイヤーへの歩数が増える方向
+	DecisionHome                 // 目だけになって巣へ戻る
+	DecisionManual               // 人が入れた方向
+	DecisionRandom               // 狙うタイルへ行けないので乱数で選んだ
+)
+
+func (d GhostDecision) String() string {
+	switch d {
+	case DecisionChase:
+		return "CHASE"
+	case DecisionFlee:
+		return "FLEE"
+	case DecisionHome:
+		return "HOME"
+	case DecisionManual:
+		return "MANUAL"
+	case DecisionRandom:
+		return "RANDOM"
+	}
+	return "-"
+}
+
+func (s GhostState) String() string {
+	switch s {
+	case Normal:
+		return "NORMAL"
+	case Frightened:
+		return "FRIGHTENED"
+	case Eaten:
+		return "EATEN"
+	}
+	return fmt.Sprintf("STATE%d", int(s))
+}
+
+var (
+	debugGridColor         = color.RGBA{R: 60, G: 60, B: 60, A: 120}
+	debugIntersectionColor = color.RGBA{R: 0, G: 200, B: 0, A: 200}
+	debugBoxColor          = color.RGBA{R: 255, G: 255, B: 255, A: 160}
+	debugBlockedColor      = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+)
+
+// drawDebug はタイルの格子、分かれ道、当たり判定、ゴーストの狙いと経路、状態を重ねて描く。
+func (gs *GameScene) drawDebug(screen *ebiten.Image, cameraX, cameraY float64) {
+	viewW, viewH := screen.Bounds().Dx(), screen.Bounds().Dy()
+	minX, minY := max(0, int(cameraX)/TileSize), max(0, int(cameraY)/TileSize)
+	maxX := min(len(gs.maze[0])-1, (int(cameraX)+viewW)/TileSize)
+	maxY := min(len(gs.maze)-1, (int(cameraY)+viewH)/TileSize)
+	toScreen := func(x, y float64) (float32, float32) {
+		return float32(x - cameraX), float32(y - cameraY)
+	}
+
+	for x := minX; x <= maxX+1; x++ {
+		sx, _ := toScreen(float64(x*TileSize), 0)
+		vector.StrokeLine(screen, sx, 0, sx, float32(viewH), 1, debugGridColor, false)
+	}
+	for y := minY; y <= maxY+1; y++ {
+		_, sy := toScreen(0, float64(y*TileSize))
+		vector.StrokeLine(screen, 0, sy, float32(viewW), sy, 1, debugGridColor, false)
+	}
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			if p := (Point{X: x, Y: y}); gs.ghostExits(p) > 2 {
+				cx, cy := toScreen(TileCenter(p))
+				vector.StrokeRect(screen, cx-4, cy-4, 8, 8, 1, debugIntersectionColor, false)
+			}
+		}
+	}
+
+	for _, ghost := range gs.ghosts {
+		gs.drawGhostPlan(screen, ghost, toScreen)
+	}
+	for _, player := range gs.players {
+		if player.Alive() {
+			gs.drawCollisionBox(screen, &player.Actor, toScreen)
+		}
+	}
+	for _, ghost := range gs.ghosts {
+		gs.drawCollisionBox(screen, &ghost.Actor, toScreen)
+		x, y := toScreen(ghost.RenderPosition(gs.alpha))
+		label := ghost.State.String()
+		if ghost.State == Frightened {
+			label += fmt.Sprintf(" %.1f", ghost.FrightenedTimer)
+		}
+		drawTextCentered(screen, label, x, y-TileSize, 1, ghost.Color)
+		drawTextCentered(screen, ghost.decision.String(), x, y-TileSize+7, 1, ghost.Color)
+	}
+}
+
+// ghostExits はゴーストが p から進める方向の数を返す。扉・トンネル・一方通行はゴーストの経路探索と同じに扱う。
+func (gs *GameScene) ghostExits(p Point) int {
+	exits := 0
+	for _, dir := range Directions {
+		if _, ok := gs.ghostPaths.Step(p, dir); ok {
+			exits++
+		}
+	}
+	return exits
+}
+
+// drawGhostPlan はゴーストが最後に狙ったタイルを枠で囲み、そこまでの最短経路を線で結ぶ。
+// いじけ中は狙ったプレイヤーから離れようとしているので、経路は描かない。
+func (gs *GameScene) drawGhostPlan(screen *ebiten.Image, ghost *Ghost, toScreen func(x, y float64) (float32, float32)) {
+	if ghost.decision == DecisionNone {
+		return
+	}
+	tx, ty := toScreen(float64(ghost.target.X*TileSize), float64(ghost.target.Y*TileSize))
+	vector.StrokeRect(screen, tx+1, ty+1, TileSize-2, TileSize-2, 2, ghost.Color, false)
+	if ghost.decision == DecisionFlee {
+		vector.StrokeLine(screen, tx+4, ty+4, tx+TileSize-4, ty+TileSize-4, 2, ghost.Color, false)
+		vector.StrokeLine(screen, tx+TileSize-4, ty+4, tx+4, ty+TileSize-4, 2, ghost.Color, false)
+		return
+	}
+
+	from := ghost.Tile()
+	prev := from
+	for _, tile := range gs.ghostPaths.BFS(from, ghost.target) {
+		// トンネルの反対側へ抜ける所は線を引かない
+		if abs(float64(tile.X-prev.X))+abs(float64(tile.Y-prev.Y)) == 1 {
+			x0, y0 := toScreen(TileCenter(prev))
+			x1, y1 := toScreen(TileCenter(tile))
+			vector.StrokeLine(screen, x0, y0, x1, y1, 2, ghost.Color, false)
+		}
+		prev = tile
+	}
+}
+
+// drawCollisionBox は当たり判定の四隅 (checkPoints) を結んだ枠を描く。壁にかかっている隅は赤くする。
+func (gs *GameScene) drawCollisionBox(screen *ebiten.Image, a *Actor, toScreen func(x, y float64) (float32, float32)) {
+	renderX, renderY := a.RenderPosition(gs.alpha)
+	x, y := toScreen(renderX-ActorRadius, renderY-ActorRadius)
+	size := float32(2 * ActorRadius)
+	vector.StrokeRect(screen, x, y, size, size, 1, debugBoxColor, false)
+	for _, point := range checkPoints(a.X, a.Y) {
+		clr := debugBoxColor
+		if tileX, tileY, ok := wrapTile(point.px, point.py, gs.maze); !ok || a.blocks(gs.maze[tileY][tileX]) {
+			clr = debugBlockedColor
+		}
+		px, py := toScreen(point.px-a.X+renderX, point.py-a.Y+renderY)
+		vector.DrawFilledRect(screen, px-1.5, py-1.5, 3, 3, clr, false)
+	}
+}
+
+// drawFrameRate は描画 (FPS) と更新 (TPS) の実測値を右上に描く。
+func drawFrameRate(screen *ebiten.Image) {
+	line := fmt.Sprintf("FPS %.0f TPS %.0f", ebiten.ActualFPS(), ebiten.ActualTPS())
+	x := float32(screen.Bounds().Dx()) - textWidth(line, 2) - 10
+	drawText(screen, line, x, 10, 2, debugIntersectionColor)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// DebugHistoryFrames は開発者モードで巻き戻せるステップ数。
+const DebugHistoryFrames = 600
+
+// Debugger は開発者モード。GameScene の代わりにシミュレーションを進め、止めたり1ステップずつ動かしたり巻き戻したりできる。
+// 右側のパネルに選んだものの全フィールドを表示し、その場で書き換えられる。
+//
+//	F4: 開発者モードの切り替え     Space: 一時停止 / 再開
+//	. / ,: 1ステップ進める / 戻す (押し続けると連続)
+//	PageUp / PageDown: 調べる対象を選ぶ
+//	左クリック: 選んだプレイヤー・ゴーストをそのタイルへ移す
+//	N / F / E: 選んだゴーストを通常 / イジケ / 目だけにする
+//
+// 巻き戻した所から進めると記録をたどり直す。記録の途中で再開したり書き換えたりすると、それより先の記録は捨てる。
+type Debugger struct {
+	gs       *GameScene
+	history  []*GameSnapshot // 古い順。history[cursor] が今の状態
+	cursor   int
+	paused   bool
+	selected int   // 0: GameScene、続いてプレイヤー、ゴーストの順
+	ended    Scene // 決着したステップの結果。Enter で移る
+	reached  int   // いちばん先まで進めたフレーム。ここまでは記録を書き直さない
+	keys     keyRepeater
+}
+
+func NewDebugger(gs *GameScene) *Debugger {
+	d := &Debugger{gs: gs, paused: true}
+	d.history = []*GameSnapshot{gs.Snapshot(0)}
+	gs.sound.StopLoop()
+	return d
+}
+
+// Update はシミュレーションを進め、決着したら Enter が押されるまでその直前で止めておく。
+func (d *Debugger) Update() Scene {
+	gs := d.gs
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) && d.ended == nil {
+		d.paused = !d.paused
+		if d.paused {
+			gs.sound.StopLoop()
+		} else {
+			d.truncate()
+			gs.clock.Reset()
+		}
+	}
+	d.handleSelection()
+	d.handleEdits()
+
+	if d.paused {
+		switch {
+		case d.keys.repeated(ebiten.KeyComma):
+			d.stepBack()
+		case d.keys.repeated(ebiten.KeyPeriod):
+			d.stepForward()
+		}
+		gs.alpha = 1
+	} else {
+		gs.alpha = gs.clock.Advance(d.step)
+	}
+
+	if d.ended != nil && inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		next := d.ended
+		// 同じ GameScene で続ける場面 (交代制など) のために、記録をやり直す
+		d.ended = nil
+		d.history, d.cursor, d.reached = []*GameSnapshot{gs.Snapshot(0)}, 0, 0
+		return next
+	}
+	return gs
+}
+
+// step は1ステップ進めて記録する。決着したら止めて false を返す。
+// 巻き戻してから一度進めたフレームをもう一度進めるときは、出来事をテレメトリに書かない。
+func (d *Debugger) step(dt float64) bool {
+	gs := d.gs
+	frame := d.history[d.cursor].Frame + 1
+	gs.telemetry.SetReplaying(frame <= d.reached)
+	next := gs.Step(dt)
+	gs.telemetry.SetReplaying(false)
+	d.reached = max(d.reached, frame)
+	d.record()
+	if next != Scene(gs) {
+		d.ended = next
+		d.paused = true
+		return false
+	}
+	return true
+}
+
+func (d *Debugger) record() {
+	frame := d.history[d.cursor].Frame + 1
+	d.history = append(d.history[:d.cursor+1], d.gs.Snapshot(frame))
+	if len(d.history) > DebugHistoryFrames {
+		d.history = d.history[len(d.history)-DebugHistoryFrames:]
+	}
+	d.cursor = len(d.history) - 1
+}
+
+// truncate は今より先の記録を捨てる。
+func (d *Debugger) truncate() {
+	d.history = d.history[:d.cursor+1]
+}
+
+func (d *Debugger) stepBack() {
+	if d.cursor == 0 {
+		return
+	}
+	d.cursor--
+	d.gs.Restore(d.history[d.cursor])
+	d.ended = nil
+}
+
+func (d *Debugger) stepForward() {
+	if d.cursor < len(d.history)-1 {
+		d.cursor++
+		d.gs.Restore(d.history[d.cursor])
+		return
+	}
+	if d.ended == nil {
+		d.step(d.gs.clock.Dt())
+	}
+}
+
+func (d *Debugger) handleSelection() {
+	count := 1 + len(d.gs.players) + len(d.gs.ghosts)
+	if inpututil.IsKeyJustPressed(ebiten.KeyPageDown) {
+		d.selected = (d.selected + 1) % count
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyPageUp) {
+		d.selected = (d.selected + count - 1) % count
+	}
+}
+
+// selectedActor は選んでいるプレイヤーかゴーストの Actor を返す。GameScene を選んでいるときは nil。
+func (d *Debugger) selectedActor() *Actor {
+	if player := d.selectedPlayer(); player != nil {
+		return &player.Actor
+	}
+	if ghost := d.selectedGhost(); ghost != nil {
+		return &ghost.Actor
+	}
+	return nil
+}
+
+func (d *Debugger) selectedPlayer() *Player {
+	if i := d.selected - 1; i >= 0 && i < len(d.gs.players) {
+		return d.gs.players[i]
+	}
+	return nil
+}
+
+func (d *Debugger) selectedGhost() *Ghost {
+	if i := d.selected - 1 - len(d.gs.players); i >= 0 && i < len(d.gs.ghosts) {
+		return d.gs.ghosts[i]
+	}
+	return nil
+}
+
+// handleEdits はクリックでの移動とゴーストの状態の書き換えを行う。書き換えた状態は今のステップの記録にする。
+func (d *Debugger) handleEdits() {
+	gs := d.gs
+	edited := false
+	if actor := d.selectedActor(); actor != nil && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		x, y := LogicalCursorPosition()
+		cameraX, cameraY := gs.camera.RenderPosition(gs.alpha)
+		tile := Point{X: floorDiv(float64(x)+cameraX, TileSize), Y: floorDiv(float64(y)+cameraY, TileSize)}
+		if tile.Y >= 0 && tile.Y < len(gs.maze) && tile.X >= 0 && tile.X < len(gs.maze[0]) && !actor.blocks(gs.maze[tile.Y][tile.X]) {
+			actor.X, actor.Y = TileCenter(tile)
+			actor.BeginStep()
+			edited = true
+		}
+	}
+	if ghost := d.selectedGhost(); ghost != nil {
+		switch {
+		case inpututil.IsKeyJustPressed(ebiten.KeyN):
+			ghost.setState(Normal, gs.elapsed)
+			ghost.FrightenedTimer = 0
+			edited = true
+		case inpututil.IsKeyJustPressed(ebiten.KeyF):
+			ghost.SetFrightened(gs.frightenedDuration, gs.elapsed)
+			edited = true
+		case inpututil.IsKeyJustPressed(ebiten.KeyE):
+			ghost.SetEaten(gs.elapsed)
+			edited = true
+		}
+	}
+	if edited {
+		d.truncate()
+		d.history[d.cursor] = gs.Snapshot(d.history[d.cursor].Frame)
+		d.ended = nil
+	}
+}
+
+// Draw は選んだものに印を付け、右側に状態のパネルを描く。
+func (d *Debugger) Draw(screen *ebiten.Image) {
+	gs := d.gs
+	screenWidth, screenHeight := ScreenSize()
+	if actor := d.selectedActor(); actor != nil {
+		cameraX, cameraY := gs.camera.RenderPosition(gs.alpha)
+		x, y := actor.RenderPosition(gs.alpha)
+		vector.StrokeCircle(screen, float32(x-cameraX), float32(y-cameraY), float32(ActorRadius+6), 1, debugBlockedColor, true)
+	}
+
+	const panelWidth = 220
+	const lineHeight = 8
+	left := float32(screenWidth - panelWidth)
+	vector.DrawFilledRect(screen, left, 0, panelWidth, float32(screenHeight), color.RGBA{A: 200}, false)
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	gray := color.RGBA{R: 160, G: 160, B: 160, A: 255}
+
+	status := "RUNNING"
+	switch {
+	case d.ended != nil:
+		status = "ENDED - ENTER"
+	case d.paused:
+		status = "PAUSED"
+	}
+	lines := []string{
+		status,
+		fmt.Sprintf("FRAME %d  HISTORY %d/%d", d.history[d.cursor].Frame, d.cursor+1, len(d.history)),
+		"SPACE PAUSE  . STEP  , BACK",
+		"PGUP/PGDN SELECT  CLICK MOVE",
+		"N/F/E GHOST STATE",
+		"",
+	}
+	header := len(lines)
+	var name string
+	var target reflect.Value
+	switch {
+	case d.selectedPlayer() != nil:
+		name, target = fmt.Sprintf("PLAYER %d", d.selected), reflect.ValueOf(d.selectedPlayer()).Elem()
+	case d.selectedGhost() != nil:
+		name, target = fmt.Sprintf("GHOST %d", d.selected-len(gs.players)), reflect.ValueOf(d.selectedGhost()).Elem()
+	default:
+		name, target = "GAMESCENE", reflect.ValueOf(gs).Elem()
+	}
+	lines = append(lines, "> "+name)
+	lines = appendFields(lines, target)
+
+	for i, line := range lines {
+		clr := white
+		if i < header {
+			clr = gray
+		}
+		drawText(screen, line, left+6, 6+float32(i*lineHeight), 1, clr)
+	}
+}
+
+// appendFields は構造体 v の全フィールドを「名前 値」の行にして足す。埋め込んだ構造体は展開する。
+// フォントが大文字しか持たないので、名前は大文字にする。
+func appendFields(lines []string, v reflect.Value) []string {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			lines = appendFields(lines, value)
+			continue
+		}
+		lines = append(lines, strings.ToUpper(field.Name+" "+formatField(value)))
+	}
+	return lines
+}
+
+func formatField(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return fmt.Sprintf("%.2f", v.Float())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.CanInterface() {
+			if s, ok := v.Interface().(fmt.Stringer); ok {
+				return s.String()
+			}
+		}
+		return fmt.Sprint(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(v.Uint())
+	case reflect.Bool:
+		return fmt.Sprint(v.Bool())
+	case reflect.String:
+		return v.String()
+	case reflect.Slice, reflect.Map:
+		return fmt.Sprintf("LEN %d", v.Len())
+	case reflect.Struct:
+		parts := make([]string, v.NumField())
+		for i := range parts {
+			parts[i] = formatField(v.Field(i))
+		}
+		return "(" + strings.Join(parts, ",") + ")"
+	case reflect.Pointer, reflect.Interface, reflect.Func:
+		if v.IsNil() {
+			return "NIL"
+		}
+		if v.Kind() == reflect.Func {
+			return "FUNC"
+		}
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+	}
+	return strings.ReplaceAll(v.Type().String(), "main.", "")
+}
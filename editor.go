@@ -0,0 +1,511 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	editorBarHeight = 2 * TileSize // 画面下のステータスバーの高さ
+	editorMinTilesX = 20           // ステータスバーの文字が収まる最小の幅 (タイル数)
+	maxEditorUndo   = 100
+
+	editorMessageDuration = 3 * time.Second // 保存などのメッセージを表示する時間
+
+	MinEditorMazeSize = 5
+	MaxEditorMazeSize = 99
+)
+
+// タイル以外を置くブラシ
+const (
+	brushPlayer = -1
+	brushGhost  = -2
+)
+
+var editorBrushes = []struct {
+	name string
+	tile int
+}{
+	{"WALL", TileWall},
+	{"DOT", TileDot},
+	{"PELLET", TilePellet},
+	{"DOOR", TileDoor},
+	{"TUNNEL", TileTunnel},
+	{"EMPTY", TileEmpty},
+	{"PLAYER", brushPlayer},
+	{"GHOST", brushGhost},
+}
+
+var (
+	editorGridColor    = color.RGBA{R: 40, G: 40, B: 40, A: 255}
+	editorErrorColor   = color.RGBA{R: 255, G: 60, B: 60, A: 255}
+	editorWarningColor = color.RGBA{R: 255, G: 200, B: 0, A: 255}
+	editorBarColor     = color.RGBA{R: 20, G: 20, B: 40, A: 255}
+	editorTextColor    = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+// EditorScene は迷路エディタ。
+//
+//	左クリック: ブラシで塗る    右クリック: 消す (通路にする)
+//	1-8 / ホイール: ブラシ選択  矢印: スクロール  Shift+矢印: 大きさを変える
+//	Ctrl+Z / Ctrl+Y: 元に戻す / やり直す
+//	F5: テストプレイ            Ctrl+S: 保存     Esc: タイトルへ
+type EditorScene struct {
+	app      *App // nil の場合は Esc でタイトルに戻らない
+	maze     *Maze
+	path     string // 保存先
+	brush    int
+	undo     []*Maze
+	redo     []*Maze
+	report   *ValidationReport
+	renderer *MazeRenderer
+
+	// ドラッグ中の状態。1回のドラッグをまとめて1回の Undo で戻せるようにする
+	painting  bool
+	strokeSet bool
+	lastPaint Point
+
+	cameraX int // 表示している左上のタイル
+	cameraY int
+
+	message      string
+	messageUntil time.Time
+	keys         keyRepeater
+}
+
+func NewEditorScene(app *App, maze *Maze, path string) *EditorScene {
+	e := &EditorScene{
+		app:      app,
+		maze:     maze.Clone(),
+		path:     path,
+		renderer: NewMazeRenderer(WallColorForLevel(1)),
+	}
+	e.validate()
+	e.enter()
+	return e
+}
+
+// NewBlankMaze は外周だけが壁で中をドットで埋めた迷路を作る。
+func NewBlankMaze(width, height int) *Maze {
+	m := &Maze{PlayerStart: Point{X: width / 2, Y: height / 2}}
+	for y := 0; y < height; y++ {
+		row := make([]int, width)
+		for x := range row {
+			if x == 0 || y == 0 || x == width-1 || y == height-1 {
+				row[x] = TileWall
+			} else {
+				row[x] = TileDot
+			}
+		}
+		m.Tiles = append(m.Tiles, row)
+	}
+	m.Tiles[m.PlayerStart.Y][m.PlayerStart.X] = TileEmpty
+	return m
+}
+
+// enter は迷路の大きさに合わせて論理解像度を設定する。テストプレイから戻ったときにも呼ぶ。
+func (e *EditorScene) enter() {
+	viewW, viewH := e.viewTiles()
+	SetScreenSize(max(viewW, editorMinTilesX)*TileSize, viewH*TileSize+editorBarHeight)
+	e.cameraX = clampInt(e.cameraX, 0, max(0, e.maze.Width()-viewW))
+	e.cameraY = clampInt(e.cameraY, 0, max(0, e.maze.Height()-viewH))
+}
+
+// viewTiles は一度に表示するタイル数を返す。
+func (e *EditorScene) viewTiles() (int, int) {
+	return min(e.maze.Width(), MaxScreenTilesX), min(e.maze.Height(), MaxScreenTilesY)
+}
+
+func (e *EditorScene) Update() Scene {
+	ctrl := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+
+	switch {
+	case ctrl && (inpututil.IsKeyJustPressed(ebiten.KeyY) || (shift && inpututil.IsKeyJustPressed(ebiten.KeyZ))):
+		e.redoEdit()
+	case ctrl && inpututil.IsKeyJustPressed(ebiten.KeyZ):
+		e.undoEdit()
+	case ctrl && inpututil.IsKeyJustPressed(ebiten.KeyS):
+		e.save()
+	case inpututil.IsKeyJustPressed(ebiten.KeyF5):
+		return e.playTest()
+	case e.app != nil && inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		return e.app.Title()
+	}
+
+	for i := range editorBrushes {
+		if inpututil.IsKeyJustPressed(ebiten.Key1 + ebiten.Key(i)) {
+			e.brush = i
+		}
+	}
+	if _, wheel := ebiten.Wheel(); wheel > 0 {
+		e.brush = (e.brush + len(editorBrushes) - 1) % len(editorBrushes)
+	} else if wheel < 0 {
+		e.brush = (e.brush + 1) % len(editorBrushes)
+	}
+
+	dx, dy := 0, 0
+	switch {
+	case e.keys.repeated(ebiten.KeyArrowLeft):
+		dx = -1
+	case e.keys.repeated(ebiten.KeyArrowRight):
+		dx = 1
+	case e.keys.repeated(ebiten.KeyArrowUp):
+		dy = -1
+	case e.keys.repeated(ebiten.KeyArrowDown):
+		dy = 1
+	}
+	if dx != 0 || dy != 0 {
+		if shift {
+			e.resize(e.maze.Width()+dx, e.maze.Height()+dy)
+		} else {
+			e.cameraX += dx
+			e.cameraY += dy
+			e.enter()
+		}
+	}
+
+	e.handleMouse()
+	return e
+}
+
+// キーを押し続けたときの繰り返し
+const (
+	keyRepeatDelay    = time.Second / 3  // 押してから繰り返し始めるまで
+	keyRepeatInterval = time.Second / 15 // 繰り返しの間隔
+)
+
+// keyRepeater は押した瞬間と、押し続けている間一定間隔でキーを繰り返す。
+// 間隔はフレーム数でなく経過時間で測るので、フレームレートが変わっても繰り返しの速さは同じ。
+type keyRepeater struct {
+	next map[ebiten.Key]time.Time // 押し続けているキーを次に繰り返す時刻
+}
+
+// repeated は key を押した瞬間と、繰り返す時刻になったときに true を返す。
+func (r *keyRepeater) repeated(key ebiten.Key) bool {
+	now := time.Now()
+	if r.next == nil {
+		r.next = map[ebiten.Key]time.Time{}
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(key):
+		r.next[key] = now.Add(keyRepeatDelay)
+		return true
+	case !ebiten.IsKeyPressed(key):
+		delete(r.next, key)
+		return false
+	}
+	next, ok := r.next[key]
+	if !ok || now.Before(next) {
+		return false
+	}
+	r.next[key] = now.Add(keyRepeatInterval)
+	return true
+}
+
+func (e *EditorScene) handleMouse() {
+	left := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	right := ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight)
+	if !left && !right {
+		e.painting = false
+		return
+	}
+	if !e.painting {
+		e.painting = true
+		e.strokeSet = false
+		e.lastPaint = Point{X: -1, Y: -1}
+	}
+
+	p, ok := e.hoveredTile()
+	if !ok || p == e.lastPaint {
+		return
+	}
+	e.lastPaint = p
+	if right {
+		e.erase(p)
+	} else {
+		e.paint(p, editorBrushes[e.brush].tile)
+	}
+}
+
+// hoveredTile はマウスカーソルの下にあるタイルを返す。
+func (e *EditorScene) hoveredTile() (Point, bool) {
+	x, y := LogicalCursorPosition()
+	viewW, viewH := e.viewTiles()
+	if x < 0 || y < 0 || x >= viewW*TileSize || y >= viewH*TileSize {
+		return Point{}, false
+	}
+	return Point{X: x/TileSize + e.cameraX, Y: y/TileSize + e.cameraY}, true
+}
+
+// beginEdit は変更の直前に呼び、ドラッグごとに1回だけ Undo 用の状態を保存する。
+func (e *EditorScene) beginEdit() {
+	if e.painting && e.strokeSet {
+		return
+	}
+	e.strokeSet = true
+	e.undo = append(e.undo, e.maze.Clone())
+	if len(e.undo) > maxEditorUndo {
+		e.undo = e.undo[1:]
+	}
+	e.redo = nil
+}
+
+func (e *EditorScene) paint(p Point, brush int) {
+	tile := e.maze.Tiles[p.Y][p.X]
+	switch brush {
+	case brushPlayer:
+		if e.maze.PlayerStart == p {
+			return
+		}
+		e.beginEdit()
+		e.maze.PlayerStart = p
+	case brushGhost:
+		if e.ghostIndexAt(p) >= 0 {
+			return
+		}
+		e.beginEdit()
+		e.maze.GhostStarts = append(e.maze.GhostStarts, p)
+	default:
+		if tile == brush {
+			return
+		}
+		e.beginEdit()
+		e.setTile(p, brush)
+		e.validate()
+		return
+	}
+	// 初期位置は壁や扉の上には置けないので通路にする
+	if tile == TileWall || tile == TileDoor {
+		e.setTile(p, TileEmpty)
+	}
+	e.validate()
+}
+
+func (e *EditorScene) erase(p Point) {
+	i := e.ghostIndexAt(p)
+	if i < 0 && e.maze.Tiles[p.Y][p.X] == TileEmpty {
+		return
+	}
+	e.beginEdit()
+	if i >= 0 {
+		e.maze.GhostStarts = append(e.maze.GhostStarts[:i], e.maze.GhostStarts[i+1:]...)
+	}
+	e.setTile(p, TileEmpty)
+	e.validate()
+}
+
+func (e *EditorScene) setTile(p Point, tile int) {
+	old := e.maze.Tiles[p.Y][p.X]
+	e.maze.Tiles[p.Y][p.X] = tile
+	if old == TileWall || old == TileDoor || tile == TileWall || tile == TileDoor {
+		e.renderer.InvalidateWalls()
+	}
+	e.renderer.InvalidateDotAt(p.X, p.Y)
+}
+
+func (e *EditorScene) ghostIndexAt(p Point) int {
+	for i, g := range e.maze.GhostStarts {
+		if g == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// resize は迷路の右端と下端でタイルを増減する。増えた部分は壁で埋める。
+func (e *EditorScene) resize(width, height int) {
+	width = clampInt(width, MinEditorMazeSize, MaxEditorMazeSize)
+	height = clampInt(height, MinEditorMazeSize, MaxEditorMazeSize)
+	if width == e.maze.Width() && height == e.maze.Height() {
+		return
+	}
+	e.beginEdit()
+
+	tiles := make([][]int, height)
+	for y := range tiles {
+		tiles[y] = make([]int, width)
+		for x := range tiles[y] {
+			tiles[y][x] = TileWall
+			if y < e.maze.Height() && x < e.maze.Width() {
+				tiles[y][x] = e.maze.Tiles[y][x]
+			}
+		}
+	}
+	e.maze.Tiles = tiles
+	e.maze.PlayerStart.X = min(e.maze.PlayerStart.X, width-1)
+	e.maze.PlayerStart.Y = min(e.maze.PlayerStart.Y, height-1)
+	ghosts := e.maze.GhostStarts[:0]
+	for _, g := range e.maze.GhostStarts {
+		if g.X < width && g.Y < height {
+			ghosts = append(ghosts, g)
+		}
+	}
+	e.maze.GhostStarts = ghosts
+	e.reload()
+}
+
+func (e *EditorScene) undoEdit() {
+	if len(e.undo) == 0 {
+		return
+	}
+	e.redo = append(e.redo, e.maze)
+	e.maze = e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
+	e.reload()
+}
+
+func (e *EditorScene) redoEdit() {
+	if len(e.redo) == 0 {
+		return
+	}
+	e.undo = append(e.undo, e.maze)
+	e.maze = e.redo[len(e.redo)-1]
+	e.redo = e.redo[:len(e.redo)-1]
+	e.reload()
+}
+
+// reload は迷路全体が入れ替わったときに、描画キャッシュ・画面サイズ・検査結果を作り直す。
+func (e *EditorScene) reload() {
+	e.renderer.InvalidateWalls()
+	e.renderer.InvalidateDots()
+	e.enter()
+	e.validate()
+}
+
+func (e *EditorScene) validate() {
+	e.report = ValidateMaze(e.maze)
+}
+
+func (e *EditorScene) save() {
+	f, err := os.Create(e.path)
+	if err == nil {
+		err = FormatMaze(f, e.maze)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		e.setMessage("SAVE FAILED: " + err.Error())
+		return
+	}
+	e.setMessage("SAVED " + e.path)
+	if e.app != nil {
+		// タイトルから PLAY を選んだときに保存した迷路で遊べるようにする
+		e.app.Maze = e.maze.Clone()
+		e.app.MazePath = e.path
+	}
+}
+
+func (e *EditorScene) setMessage(msg string) {
+	e.message = msg
+	e.messageUntil = time.Now().Add(editorMessageDuration)
+}
+
+// playTest は編集中の迷路でゲームを始める。ゲームを抜けるとエディタに戻る。
+func (e *EditorScene) playTest() Scene {
+	config := GameConfig{SimulationRate: DefaultSimulationRate, Seed: time.Now().UnixNano()}
+	if e.app != nil {
+		config = e.app.Config
+	}
+	m := e.maze.Clone()
+	SetScreenSizeForMaze(m)
+	gs := NewGameScene(m, config)
+	gs.exit = func() Scene {
+		e.enter()
+		return e
+	}
+	return gs
+}
+
+func (e *EditorScene) Draw(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{R: 0, G: 0, B: 0, A: 255})
+	viewW, viewH := e.viewTiles()
+	view := screen.SubImage(image.Rect(0, 0, viewW*TileSize, viewH*TileSize)).(*ebiten.Image)
+	cameraX := float64(e.cameraX * TileSize)
+	cameraY := float64(e.cameraY * TileSize)
+
+	for x := 0; x <= viewW; x++ {
+		vector.StrokeLine(view, float32(x*TileSize), 0, float32(x*TileSize), float32(viewH*TileSize), 1, editorGridColor, false)
+	}
+	for y := 0; y <= viewH; y++ {
+		vector.StrokeLine(view, 0, float32(y*TileSize), float32(viewW*TileSize), float32(y*TileSize), 1, editorGridColor, false)
+	}
+	e.renderer.Draw(view, e.maze.Tiles, cameraX, cameraY)
+
+	for i, g := range e.maze.GhostStarts {
+		x, y := TileCenter(g)
+		drawGhost(view, &Ghost{Color: ghostColors[i%len(ghostColors)]}, x-cameraX, y-cameraY, 0)
+	}
+	x, y := TileCenter(e.maze.PlayerStart)
+	drawPlayer(view, x-cameraX, y-cameraY, 1, 0, 0.5, PlayerColor)
+
+	for _, issue := range e.report.Issues {
+		clr := editorWarningColor
+		if issue.Severity == SeverityError {
+			clr = editorErrorColor
+		}
+		e.strokeTile(view, Point{X: issue.X, Y: issue.Y}, clr)
+	}
+	if p, ok := e.hoveredTile(); ok {
+		e.strokeTile(view, p, editorTextColor)
+	}
+
+	e.drawStatusBar(screen, viewH*TileSize)
+}
+
+func (e *EditorScene) strokeTile(dst *ebiten.Image, p Point, clr color.Color) {
+	x := float32((p.X - e.cameraX) * TileSize)
+	y := float32((p.Y - e.cameraY) * TileSize)
+	vector.StrokeRect(dst, x+1, y+1, TileSize-2, TileSize-2, 2, clr, false)
+}
+
+func (e *EditorScene) drawStatusBar(screen *ebiten.Image, top int) {
+	width, _ := ScreenSize()
+	vector.DrawFilledRect(screen, 0, float32(top), float32(width), editorBarHeight, editorBarColor, false)
+
+	errors, warnings := 0, 0
+	for _, issue := range e.report.Issues {
+		if issue.Severity == SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	status := fmt.Sprintf("%d:%s  %dX%d  ERRORS %d  WARNINGS %d", e.brush+1, editorBrushes[e.brush].name,
+		e.maze.Width(), e.maze.Height(), errors, warnings)
+	drawText(screen, status, 8, float32(top+8), 2, editorTextColor)
+
+	line := "F5 TEST  CTRL+S SAVE  CTRL+Z UNDO  SHIFT+ARROWS RESIZE"
+	clr := color.Color(editorTextColor)
+	switch {
+	case time.Now().Before(e.messageUntil):
+		line = e.message
+	case len(e.report.Issues) > 0:
+		// 最も重要な問題をひとつ表示する。エラーは警告より先に並んでいるとは限らない
+		issue := e.report.Issues[0]
+		for _, i := range e.report.Issues {
+			if i.Severity == SeverityError {
+				issue = i
+				break
+			}
+		}
+		line = issue.String()
+		clr = editorWarningColor
+		if issue.Severity == SeverityError {
+			clr = editorErrorColor
+		}
+	}
+	drawText(screen, line, 8, float32(top+34), 2, clr)
+}
+
+func clampInt(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
@@ -0,0 +1,238 @@
+package main
+
+// Action はエージェントの行動。次の Step まで押し続ける方向キーを表す。
+type Action int
+
+const (
+	ActionNone Action = iota
+	ActionUp
+	ActionDown
+	ActionLeft
+	ActionRight
+	NumActions
+)
+
+var actionNames = []string{"none", "up", "down", "left", "right"}
+
+var actionDirections = []Point{
+	ActionNone:  {},
+	ActionUp:    {X: 0, Y: -1},
+	ActionDown:  {X: 0, Y: 1},
+	ActionLeft:  {X: -1, Y: 0},
+	ActionRight: {X: 1, Y: 0},
+}
+
+func (a Action) String() string {
+	if a < 0 || a >= NumActions {
+		return "invalid"
+	}
+	return actionNames[a]
+}
+
+// 観測テンソルのチャンネル。値は 0 か 1 (ゴーストのチャンネルだけは同じタイルにいる数)
+const (
+	ChannelWall = iota
+	ChannelDoor
+	ChannelDot
+	ChannelPellet
+	ChannelTunnel
+	ChannelPlayer
+	ChannelGhostNormal
+	ChannelGhostFrightened
+	ChannelGhostEaten
+	NumChannels
+)
+
+var channelNames = []string{"wall", "door", "dot", "pellet", "tunnel", "player", "ghost_normal", "ghost_frightened", "ghost_eaten"}
+
+// Observation は1ステップ分の観測。Tensor は [チャンネル][行][列] の順に平らに並べたもの。
+type Observation struct {
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	Tensor  []float32 `json:"tensor"`
+	PlayerX float64   `json:"playerX"` // タイル単位の位置 (タイルの中心が x.5)
+	PlayerY float64   `json:"playerY"`
+	Score   int       `json:"score"`
+}
+
+// At はチャンネル c のタイル (x, y) の値を返す。
+func (o *Observation) At(c, x, y int) float32 {
+	return o.Tensor[(c*o.Height+y)*o.Width+x]
+}
+
+// RewardConfig は報酬の与え方。各イベントが起きたステップでその値を加える。
+type RewardConfig struct {
+	Dot    float64 `json:"dot"`
+	Pellet float64 `json:"pellet"`
+	Ghost  float64 `json:"ghost"`
+	Clear  float64 `json:"clear"`
+	Death  float64 `json:"death"`
+	Step   float64 `json:"step"` // 毎ステップ加える値。負にすると早く終わらせるように学習する
+}
+
+// DefaultRewardConfig はスコアと同じ比率の報酬。
+func DefaultRewardConfig() RewardConfig {
+	return RewardConfig{Dot: 10, Pellet: 50, Ghost: 200, Clear: 1000, Death: -500}
+}
+
+type EnvConfig struct {
+	Maze      *Maze
+	Game      GameConfig // Controllers と Seed は環境が設定する
+	Rewards   RewardConfig
+	FrameSkip int // 1回の Step で進めるシミュレーションのステップ数。0 なら 4
+	MaxSteps  int // この回数 Step したら打ち切る。0 なら無制限
+}
+
+// StepInfo は報酬以外の補足情報。
+type StepInfo struct {
+	Outcome       string  `json:"outcome,omitempty"` // 終了したときだけ OutcomeClear などが入る
+	Steps         int     `json:"steps"`
+	Time          float64 `json:"time"` // ゲーム内の経過時間 (秒)
+	Score         int     `json:"score"`
+	DotsRemaining int     `json:"dotsRemaining"`
+}
+
+// Env は強化学習用の環境。ゲームのルールを画面なしで1行動ずつ進め、盤面をタイルごとの
+// チャンネルに分けたテンソルとして返す。Reset でゲームを始め、Step で行動を与えて進める。
+type Env struct {
+	config EnvConfig
+	gs     *GameScene
+	action Action
+	steps  int
+	done   bool
+}
+
+func NewEnv(config EnvConfig) *Env {
+	if config.Maze == nil {
+		config.Maze = DefaultMaze()
+	}
+	if config.FrameSkip <= 0 {
+		config.FrameSkip = 4
+	}
+	return &Env{config: config}
+}
+
+// SetRewards は次のステップから使う報酬の与え方を変える。
+func (e *Env) SetRewards(rewards RewardConfig) {
+	e.config.Rewards = rewards
+}
+
+// Reset は seed で新しいゲームを始め、最初の観測を返す。
+func (e *Env) Reset(seed int64) Observation {
+	config := e.config.Game
+	config.Seed = seed
+	config.Players = 1
+	config.Controllers = []Controller{(*envController)(e)}
+	config.Sound = nil
+	e.gs = NewGameScene(e.config.Maze, config)
+	e.action = ActionNone
+	e.steps = 0
+	e.done = false
+	return e.observe()
+}
+
+// Step は action を FrameSkip ステップの間押し続けてゲームを進める。
+// 終了後に呼んだ場合は何もせず、報酬 0 で done を返す。
+func (e *Env) Step(action Action) (Observation, float64, bool, StepInfo) {
+	if e.gs == nil {
+		e.Reset(0)
+	}
+	if e.done {
+		return e.observe(), 0, true, e.info("")
+	}
+	if action < 0 || action >= NumActions {
+		action = ActionNone
+	}
+	e.action = action
+	e.steps++
+
+	before := e.gs.stats
+	rewards := e.config.Rewards
+	reward := rewards.Step
+	outcome := ""
+	dt := e.gs.clock.Dt()
+	for i := 0; i < e.config.FrameSkip && outcome == ""; i++ {
+		switch e.gs.Step(dt).(type) {
+		case *GameOverScene:
+			outcome = OutcomeDeath
+			reward += rewards.Death
+		case *StageClearScene:
+			outcome = OutcomeClear
+			reward += rewards.Clear
+		}
+	}
+	after := e.gs.stats
+	reward += float64(after.DotsEaten-before.DotsEaten) * rewards.Dot
+	reward += float64(after.PelletsEaten-before.PelletsEaten) * rewards.Pellet
+	reward += float64(after.GhostsEaten-before.GhostsEaten) * rewards.Ghost
+
+	if outcome == "" && e.config.MaxSteps > 0 && e.steps >= e.config.MaxSteps {
+		outcome = OutcomeTimeout
+	}
+	e.done = outcome != ""
+	return e.observe(), reward, e.done, e.info(outcome)
+}
+
+func (e *Env) info(outcome string) StepInfo {
+	return StepInfo{
+		Outcome:       outcome,
+		Steps:         e.steps,
+		Time:          e.gs.elapsed,
+		Score:         e.gs.Score,
+		DotsRemaining: e.gs.dotsRemaining,
+	}
+}
+
+func (e *Env) observe() Observation {
+	gs := e.gs
+	width, height := len(gs.maze[0]), len(gs.maze)
+	obs := Observation{
+		Width:   width,
+		Height:  height,
+		Tensor:  make([]float32, NumChannels*width*height),
+		PlayerX: gs.players[0].X / TileSize,
+		PlayerY: gs.players[0].Y / TileSize,
+		Score:   gs.Score,
+	}
+	set := func(c int, p Point, v float32) {
+		if p.X >= 0 && p.Y >= 0 && p.X < width && p.Y < height {
+			obs.Tensor[(c*height+p.Y)*width+p.X] += v
+		}
+	}
+
+	for y, row := range gs.maze {
+		for x, tile := range row {
+			switch tile {
+			case TileWall:
+				set(ChannelWall, Point{X: x, Y: y}, 1)
+			case TileDoor:
+				set(ChannelDoor, Point{X: x, Y: y}, 1)
+			case TileDot:
+				set(ChannelDot, Point{X: x, Y: y}, 1)
+			case TilePellet:
+				set(ChannelPellet, Point{X: x, Y: y}, 1)
+			case TileTunnel:
+				set(ChannelTunnel, Point{X: x, Y: y}, 1)
+			}
+		}
+	}
+	set(ChannelPlayer, gs.players[0].Tile(), 1)
+	for _, ghost := range gs.ghosts {
+		channel := ChannelGhostNormal
+		switch ghost.State {
+		case Frightened:
+			channel = ChannelGhostFrightened
+		case Eaten:
+			channel = ChannelGhostEaten
+		}
+		set(channel, ghost.Tile(), 1)
+	}
+	return obs
+}
+
+// envController は Env に与えられた行動をプレイヤーの入力にする。
+type envController Env
+
+func (c *envController) Input(gs *GameScene, p *Player, dt float64) PlayerInput {
+	return InputToward(actionDirections[c.action])
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+)
+
+// 環境サーバーのプロトコル。1行に1つの JSON を送ると、1行の JSON が返ってくる。
+//
+//	{"cmd": "spec"}                                  → 行動・チャンネルの一覧と盤面の大きさ
+//	{"cmd": "reset", "seed": 1, "rewards": {...}}    → {"observation": ...}  (rewards は省略可)
+//	{"cmd": "step", "action": 1}                     → {"observation": ..., "reward": 10, "done": false, "info": {...}}
+//	{"cmd": "close"}                                 → 接続を閉じる
+//
+// エラーの場合は {"error": "..."} が返る。
+type envRequest struct {
+	Cmd     string        `json:"cmd"`
+	Seed    int64         `json:"seed"`
+	Action  Action        `json:"action"`
+	Rewards *RewardConfig `json:"rewards"`
+}
+
+type envResponse struct {
+	Observation *Observation `json:"observation,omitempty"`
+	Reward      float64      `json:"reward"`
+	Done        bool         `json:"done"`
+	Info        *StepInfo    `json:"info,omitempty"`
+	Spec        *envSpec     `json:"spec,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+type envSpec struct {
+	Actions   []string `json:"actions"`
+	Channels  []string `json:"channels"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+	FrameSkip int      `json:"frameSkip"`
+	StepTime  float64  `json:"stepTime"` // 1回の step で進むゲーム内の時間 (秒)
+}
+
+// serveEnv は r から要求を読み、それぞれの接続専用の環境で処理して w に応答を書く。
+func serveEnv(r io.Reader, w io.Writer, config EnvConfig) error {
+	env := NewEnv(config)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		var req envRequest
+		var resp envResponse
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			switch req.Cmd {
+			case "spec":
+				rate := config.Game.withDefaults().SimulationRate
+				resp.Spec = &envSpec{
+					Actions:   actionNames,
+					Channels:  channelNames,
+					Width:     env.config.Maze.Width(),
+					Height:    env.config.Maze.Height(),
+					FrameSkip: env.config.FrameSkip,
+					StepTime:  float64(env.config.FrameSkip) / float64(rate),
+				}
+			case "reset":
+				if req.Rewards != nil {
+					env.SetRewards(*req.Rewards)
+				}
+				obs := env.Reset(req.Seed)
+				resp.Observation = &obs
+			case "step":
+				if req.Action < 0 || req.Action >= NumActions {
+					resp.Error = fmt.Sprintf("invalid action %d", req.Action)
+					break
+				}
+				obs, reward, done, info := env.Step(req.Action)
+				resp.Observation, resp.Reward, resp.Done, resp.Info = &obs, reward, done, &info
+			case "close":
+				return nil
+			default:
+				resp.Error = fmt.Sprintf("unknown cmd %q", req.Cmd)
+			}
+		}
+		if err := enc.Encode(&resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// runEnv は env コマンド。標準入出力か TCP で環境サーバーを動かす。
+func runEnv(args []string) error {
+	fs := flag.NewFlagSet("env", flag.ExitOnError)
+	mazePath := fs.String("maze", "", "maze file (default: built-in maze)")
+	addr := fs.String("listen", "", "serve over TCP on this address (e.g. 127.0.0.1:5555) instead of stdin/stdout")
+	frameSkip := fs.Int("frame-skip", 4, "simulation steps per env step")
+	maxSteps := fs.Int("max-steps", 0, "end an episode after this many env steps (0: no limit)")
+	rate := fs.Int("rate", DefaultSimulationRate, "simulation steps per second")
+	fs.Parse(args)
+
+	maze := DefaultMaze()
+	if *mazePath != "" {
+		var err error
+		if maze, err = LoadMaze(*mazePath); err != nil {
+			return err
+		}
+	}
+	SetScreenSizeForMaze(maze)
+	config := EnvConfig{
+		Maze:      maze,
+		Game:      GameConfig{SimulationRate: *rate},
+		Rewards:   DefaultRewardConfig(),
+		FrameSkip: *frameSkip,
+		MaxSteps:  *maxSteps,
+	}
+
+	if *addr == "" {
+		return serveEnv(os.Stdin, os.Stdout, config)
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("env: listening on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := serveEnv(conn, conn, config); err != nil {
+				log.Printf("env: %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Event はゲーム中の出来事。GameScene がルールの処理の中で EventBus に発行する。
+// 音や表示、統計など、ルールに関わらない処理は購読して行う。
+type Event interface {
+	// EventName は記録やログに使う名前。
+	EventName() string
+}
+
+// DotEaten はドットを食べたとき。
+type DotEaten struct {
+	Player int   `json:"player"` // gs.players の添字
+	Tile   Point `json:"tile"`
+	Points int   `json:"points"`
+}
+
+// PelletEaten はパワークッキーを食べたとき。ゴーストはこの後に怯える。
+type PelletEaten struct {
+	Player int   `json:"player"`
+	Tile   Point `json:"tile"`
+	Points int   `json:"points"`
+}
+
+// GhostEaten は怯えたゴーストを食べたとき。X, Y は食べた位置 (ピクセル)。
+type GhostEaten struct {
+	Player int     `json:"player"`
+	Ghost  int     `json:"ghost"` // gs.ghosts の添字
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Points int     `json:"points"`
+}
+
+// PlayerDied はプレイヤーがゴーストに捕まったとき。LivesLeft が 0 ならそのプレイヤーは退場する。
+type PlayerDied struct {
+	Player    int `json:"player"`
+	Ghost     int `json:"ghost"`
+	LivesLeft int `json:"livesLeft"`
+}
+
+// LevelCleared はドットを食べ尽くしたとき。
+type LevelCleared struct {
+	Level int `json:"level"`
+	Score int `json:"score"`
+}
+
+// GameOver は全員が退場したとき。
+type GameOver struct {
+	Level int `json:"level"`
+	Score int `json:"score"`
+}
+
+// FruitSpawned はボーナスの果物が出たとき。果物はまだないので、今はどこからも発行されない。
+type FruitSpawned struct {
+	Tile   Point `json:"tile"`
+	Points int   `json:"points"`
+}
+
+func (DotEaten) EventName() string     { return "dot_eaten" }
+func (PelletEaten) EventName() string  { return "pellet_eaten" }
+func (GhostEaten) EventName() string   { return "ghost_eaten" }
+func (PlayerDied) EventName() string   { return "player_died" }
+func (LevelCleared) EventName() string { return "level_cleared" }
+func (GameOver) EventName() string     { return "game_over" }
+func (FruitSpawned) EventName() string { return "fruit_spawned" }
+
+// EventBus は発行された出来事を、購読した順にすべてのハンドラへその場で渡す。
+// ネット対戦の巻き戻しや開発者モードでは同じステップをやり直すので、同じ出来事が2回以上届くことがある。
+type EventBus struct {
+	handlers []func(Event)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe は handler を登録する。どの出来事かは型で見分ける。
+func (b *EventBus) Subscribe(handler func(Event)) {
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *EventBus) Publish(e Event) {
+	for _, handler := range b.handlers {
+		handler(e)
+	}
+}
+
+// playSounds は出来事に合わせて効果音を鳴らす。gs.sound は後から差し替えられるので、鳴らすときに読む。
+func (gs *GameScene) playSounds(e Event) {
+	switch e.(type) {
+	case DotEaten:
+		gs.sound.PlayChomp()
+	case GhostEaten:
+		gs.sound.Play(SoundGhostEaten)
+	case PlayerDied:
+		gs.sound.Play(SoundDeath)
+	case GameOver:
+		gs.sound.StopAll()
+		gs.sound.Play(SoundDeath)
+	case LevelCleared:
+		gs.sound.StopAll()
+	}
+}
+
+// recordStats は出来事を gs.stats に数える。
+func (gs *GameScene) recordStats(e Event) {
+	switch e.(type) {
+	case DotEaten:
+		gs.stats.DotsEaten++
+	case PelletEaten:
+		gs.stats.PelletsEaten++
+	case GhostEaten:
+		gs.stats.GhostsEaten++
+	}
+}
+
+// ScorePopupDuration は得点を表示しておく秒数。
+const ScorePopupDuration = 1.0
+
+// scorePopup はゴーストを食べた位置に出す得点の表示。
+type scorePopup struct {
+	x, y    float64
+	text    string
+	expires float64 // gs.elapsed がこれを過ぎたら消す
+}
+
+// showScorePopups はゴーストを食べたときに得点を表示する。
+func (gs *GameScene) showScorePopups(e Event) {
+	if e, ok := e.(GhostEaten); ok {
+		gs.popups = append(gs.popups, scorePopup{x: e.X, y: e.Y, text: fmt.Sprint(e.Points), expires: gs.elapsed + ScorePopupDuration})
+	}
+}
+
+func (gs *GameScene) drawScorePopups(screen *ebiten.Image, cameraX, cameraY float64) {
+	popups := gs.popups[:0]
+	for _, popup := range gs.popups {
+		// 巻き戻したときは elapsed が表示を出した時刻より前に戻るので、それも消す
+		if gs.elapsed >= popup.expires || gs.elapsed < popup.expires-ScorePopupDuration {
+			continue
+		}
+		popups = append(popups, popup)
+		drawTextCentered(screen, popup.text, float32(popup.x-cameraX), float32(popup.y-cameraY)-5, 2, color.RGBA{R: 0, G: 255, B: 255, A: 255})
+	}
+	gs.popups = popups
+}
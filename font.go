@@ -0,0 +1,99 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// 5x5 のビットマップフォント。# が点灯するピクセル
+var glyphs = map[rune][5]string{
+	'A': {".###.", "#...#", "#####", "#...#", "#...#"},
+	'B': {"####.", "#...#", "####.", "#...#", "####."},
+	'C': {".###.", "#....", "#....", "#....", ".###."},
+	'D': {"####.", "#...#", "#...#", "#...#", "####."},
+	'E': {"#####", "#....", "####.", "#....", "#####"},
+	'F': {"#####", "#....", "####.", "#....", "#...."},
+	'G': {"#####", "#....", "#.###", "#...#", "#####"},
+	'H': {"#...#", "#...#", "#####", "#...#", "#...#"},
+	'I': {".###.", "..#..", "..#..", "..#..", ".###."},
+	'J': {"..###", "...#.", "...#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "###..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#...#", "#...#"},
+	'N': {"#...#", "##..#", "#.#.#", "#..##", "#...#"},
+	'O': {".###.", "#...#", "#...#", "#...#", ".###."},
+	'P': {"####.", "#...#", "####.", "#....", "#...."},
+	'Q': {".###.", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "####.", "#..#.", "#...#"},
+	'S': {".###.", "#....", ".###.", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", ".#.#.", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#.#.#", "##.##", "#...#"},
+	'X': {"#...#", ".#.#.", "..#..", ".#.#.", "#...#"},
+	'Y': {"#...#", ".#.#.", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "...#.", "..#..", ".#...", "#####"},
+	'0': {".###.", "#...#", "#...#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", ".###."},
+	'2': {".###.", "....#", ".###.", "#....", "#####"},
+	'3': {"####.", "....#", ".###.", "....#", "####."},
+	'4': {"#...#", "#...#", "#####", "....#", "....#"},
+	'5': {"#####", "#....", "####.", "....#", "####."},
+	'6': {".###.", "#....", "####.", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#..."},
+	'8': {".###.", "#...#", ".###.", "#...#", ".###."},
+	'9': {".###.", "#...#", ".####", "....#", ".###."},
+	':': {".....", ".#...", ".....", ".#...", "....."},
+	'.': {".....", ".....", ".....", ".....", ".#..."},
+	',': {".....", ".....", ".....", ".#...", "#...."},
+	'-': {".....", ".....", ".###.", ".....", "....."},
+	'+': {".....", "..#..", ".###.", "..#..", "....."},
+	'/': {"....#", "...#.", "..#..", ".#...", "#...."},
+	'>': {".#...", "..#..", "...#.", "..#..", ".#..."},
+	'!': {"..#..", "..#..", "..#..", ".....", "..#.."},
+	'?': {".###.", "...#.", "..#..", ".....", "..#.."},
+	'=': {".....", "#####", ".....", "#####", "....."},
+	'(': {"...#.", "..#..", "..#..", "..#..", "...#."},
+	')': {".#...", "..#..", "..#..", "..#..", ".#..."},
+}
+
+const (
+	glyphSize    = 5
+	glyphAdvance = 6 // 1文字あたりの幅 (ピクセル単位、文字間の1ピクセルを含む)
+)
+
+// drawText は左上 (x, y) から文字列を描く。pixelSize は1ドットの大きさ。
+// 小文字は大文字として描き、フォントにない文字は空白になる。
+func drawText(dst *ebiten.Image, text string, x, y, pixelSize float32, clr color.Color) {
+	for i, char := range strings.ToUpper(text) {
+		glyph, ok := glyphs[char]
+		if !ok {
+			continue
+		}
+		left := x + float32(i*glyphAdvance)*pixelSize
+		for row := 0; row < glyphSize; row++ {
+			for col := 0; col < glyphSize; col++ {
+				if glyph[row][col] == '#' {
+					vector.DrawFilledRect(dst, left+float32(col)*pixelSize, y+float32(row)*pixelSize, pixelSize, pixelSize, clr, false)
+				}
+			}
+		}
+	}
+}
+
+// textWidth は drawText で描いたときの幅を返す。
+func textWidth(text string, pixelSize float32) float32 {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return float32(n*glyphAdvance-1) * pixelSize
+}
+
+// drawTextCentered は x を中心として文字列を描く。
+func drawTextCentered(dst *ebiten.Image, text string, centerX, y, pixelSize float32, clr color.Color) {
+	drawText(dst, text, centerX-textWidth(text, pixelSize)/2, y, pixelSize, clr)
+}
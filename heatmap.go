@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Heatmap はタイルごとの集計値。
+type Heatmap [][]float64
+
+func NewHeatmap(width, height int) Heatmap {
+	h := make(Heatmap, height)
+	for y := range h {
+		h[y] = make([]float64, width)
+	}
+	return h
+}
+
+// Add はピクセル座標 (x, y) のタイルに v を足す。迷路の外は数えない。
+func (h Heatmap) Add(x, y, v float64) {
+	tileX, tileY := floorDiv(x, TileSize), floorDiv(y, TileSize)
+	if tileY >= 0 && tileY < len(h) && tileX >= 0 && tileX < len(h[tileY]) {
+		h[tileY][tileX] += v
+	}
+}
+
+// Merge は同じ大きさの o の値を足す。
+func (h Heatmap) Merge(o Heatmap) {
+	for y, row := range o {
+		for x, v := range row {
+			h[y][x] += v
+		}
+	}
+}
+
+func (h Heatmap) Max() float64 {
+	m := 0.0
+	for _, row := range h {
+		for _, v := range row {
+			m = max(m, v)
+		}
+	}
+	return m
+}
+
+// TelemetrySummary は複数の記録を集計した結果。どの記録も同じ大きさの迷路のものとする。
+type TelemetrySummary struct {
+	Tiles    [][]int // 最初の記録の開始時の迷路
+	Sessions int
+	Deaths   Heatmap // プレイヤーが捕まったタイル
+	Catches  Heatmap // プレイヤーを捕まえたときにゴーストのいたタイル
+	Time     Heatmap // プレイヤーがいた秒数
+}
+
+// AddLog は1回分の記録を集計に加える。迷路の大きさが違う記録や壊れた記録はエラーにし、集計には何も足さない。
+func (s *TelemetrySummary) AddLog(path string) error {
+	l, err := readTelemetryLog(path)
+	if err != nil {
+		return err
+	}
+	if s.Tiles == nil {
+		*s = *l
+		return nil
+	}
+	if len(l.Tiles) != len(s.Tiles) || len(l.Tiles[0]) != len(s.Tiles[0]) {
+		return fmt.Errorf("%s: maze is %dx%d, want %dx%d", path, len(l.Tiles[0]), len(l.Tiles), len(s.Tiles[0]), len(s.Tiles))
+	}
+	s.Sessions += l.Sessions
+	s.Deaths.Merge(l.Deaths)
+	s.Catches.Merge(l.Catches)
+	s.Time.Merge(l.Time)
+	return nil
+}
+
+// readTelemetryLog は1回分の記録を読んで集計する。
+func readTelemetryLog(path string) (*TelemetrySummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s TelemetrySummary
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	sample := TelemetrySampleInterval
+	for line := 1; scanner.Scan(); line++ {
+		var r telemetryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if s.Tiles == nil && r.Type != "start" {
+			return nil, fmt.Errorf("%s: no start record", path)
+		}
+		switch r.Type {
+		case "start":
+			if s.Tiles != nil {
+				return nil, fmt.Errorf("%s:%d: second start record", path, line)
+			}
+			tiles := parseTileRows(r.Tiles)
+			if len(tiles) == 0 || len(tiles[0]) == 0 {
+				return nil, fmt.Errorf("%s: empty maze", path)
+			}
+			s.Tiles = tiles
+			s.Deaths = NewHeatmap(len(tiles[0]), len(tiles))
+			s.Catches = NewHeatmap(len(tiles[0]), len(tiles))
+			s.Time = NewHeatmap(len(tiles[0]), len(tiles))
+			if r.Sample > 0 {
+				sample = r.Sample
+			}
+			s.Sessions = 1
+		case "pos":
+			// 脱落したプレイヤーは最後の位置に止まっているだけなので数えない
+			for i, p := range r.Players {
+				if !slices.Contains(r.Dead, i) {
+					s.Time.Add(p[0], p[1], sample)
+				}
+			}
+		case PlayerDied{}.EventName():
+			var e PlayerDied
+			if err := json.Unmarshal(r.Event, &e); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			if e.Player >= 0 && e.Player < len(r.Players) {
+				s.Deaths.Add(r.Players[e.Player][0], r.Players[e.Player][1], 1)
+			}
+			if e.Ghost >= 0 && e.Ghost < len(r.Ghosts) {
+				s.Catches.Add(r.Ghosts[e.Ghost][0], r.Ghosts[e.Ghost][1], 1)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if s.Tiles == nil {
+		return nil, fmt.Errorf("%s: no start record", path)
+	}
+	return &s, nil
+}
+
+// 熱の色。少ない方から青・赤・黄
+var heatColors = []color.RGBA{
+	{R: 0, G: 0, B: 255, A: 255},
+	{R: 255, G: 0, B: 0, A: 255},
+	{R: 255, G: 255, B: 0, A: 255},
+}
+
+// heatColor は 0〜1 の値の色を heatColors の間を補間して返す。
+func heatColor(v float64) color.RGBA {
+	v = min(1, max(0, v)) * float64(len(heatColors)-1)
+	i := min(int(v), len(heatColors)-2)
+	f := v - float64(i)
+	a, b := heatColors[i], heatColors[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*f) }
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 255}
+}
+
+// RenderHeatmap は迷路を scale ピクセルのタイルで描き、h の値を重ねた画像を返す。
+// 値は最大値を1として色を決め、値のあるタイルほど濃く重ねる。
+func RenderHeatmap(tiles [][]int, h Heatmap, scale int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(tiles[0])*scale, len(tiles)*scale))
+	peak := h.Max()
+	for y, row := range tiles {
+		for x, tile := range row {
+			base := color.RGBA{A: 255}
+			switch tile {
+			case TileWall:
+				// 熱の色と見分けやすいように、壁は灰色にする
+				base = color.RGBA{R: 70, G: 70, B: 70, A: 255}
+			case TileDoor:
+				base = color.RGBA{R: 120, G: 120, B: 120, A: 255}
+			}
+			clr := base
+			if v := h[y][x]; v > 0 && peak > 0 {
+				heat := heatColor(v / peak)
+				alpha := 0.35 + 0.65*v/peak
+				blend := func(b, c uint8) uint8 { return uint8(float64(b)*(1-alpha) + float64(c)*alpha) }
+				clr = color.RGBA{R: blend(base.R, heat.R), G: blend(base.G, heat.G), B: blend(base.B, heat.B), A: 255}
+			}
+			for py := y * scale; py < (y+1)*scale; py++ {
+				for px := x * scale; px < (x+1)*scale; px++ {
+					img.SetRGBA(px, py, clr)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// telemetryLogPaths は引数のファイルと、ディレクトリの中の *.jsonl を並べて返す。
+func telemetryLogPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// runHeatmap は heatmap コマンド。-telemetry で書いた記録を集計し、
+// 捕まった場所 (deaths.png)、捕まえたゴーストの場所 (catches.png)、プレイヤーがいた時間 (time.png) の PNG を書き出す。
+func runHeatmap(args []string) error {
+	fs := flag.NewFlagSet("heatmap", flag.ExitOnError)
+	out := fs.String("out", ".", "directory to write deaths.png, catches.png and time.png into")
+	scale := fs.Int("scale", 16, "pixels per tile")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: heatmap [flags] <log.jsonl | directory>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no logs given")
+	}
+	if *scale < 1 {
+		return fmt.Errorf("-scale must be positive")
+	}
+	paths, err := telemetryLogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	var summary TelemetrySummary
+	for _, path := range paths {
+		if err := summary.AddLog(path); err != nil {
+			// 迷路の違う記録や壊れた記録は飛ばして、残りを集計する
+			fmt.Fprintf(os.Stderr, "heatmap: skipping %v\n", err)
+		}
+	}
+	if summary.Sessions == 0 {
+		return fmt.Errorf("no usable logs")
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+
+	maps := []struct {
+		name string
+		h    Heatmap
+		unit string
+	}{
+		{"deaths", summary.Deaths, "deaths"},
+		{"catches", summary.Catches, "catches"},
+		{"time", summary.Time, "seconds"},
+	}
+	var report []string
+	for _, m := range maps {
+		path := filepath.Join(*out, m.name+".png")
+		if err := writePNG(path, RenderHeatmap(summary.Tiles, m.h, *scale)); err != nil {
+			return err
+		}
+		total := 0.0
+		for _, row := range m.h {
+			for _, v := range row {
+				total += v
+			}
+		}
+		report = append(report, fmt.Sprintf("%s: %.0f %s (max %.1f per tile)", path, total, m.unit, m.h.Max()))
+	}
+	fmt.Printf("%d sessions\n%s\n", summary.Sessions, strings.Join(report, "\n"))
+	return nil
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"image/color"
+	"flag"
+	"log"
+	"math"
 	"math/rand"
+	"os"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
 )
 
 const (
 	TileSize = 30
-	FrightenedDuration = 300 // フレーム数 (約5秒)
+	FrightenedDuration = 5.0 // 秒
+	PlayerSpeed = 4.0 // タイル/秒
+	GhostSpeed = 3.0
 )
 
 type GhostState int
@@ -19,233 +28,410 @@ type GhostState int
 const (
 	Normal GhostState = 0
 	Frightened GhostState = 1
+	Eaten GhostState = 2 // 食べられて目だけになり、巣に戻っている
+)
+
+const EatenSpeedMultiplier = 2.0 // 目だけのゴーストが巣に戻る速さ (通常の何倍か)
+
+// ゲームごとの乱数のシードで変わるゴーストの動き。シードが同じなら同じ動きになる。
+// 出発の向き・巣を出るまでの時間はゴーストごとにゲームの始めに決め、分かれ道ではときどき狙いを外して曲がる
+const (
+	GhostReleaseJitter = 1.5  // 巣を出るまで待つ時間の最大 (秒)
+	GhostWanderChance  = 0.15 // 通常の状態で、分かれ道で狙いと関係なく曲がる確率
 )
 
 type Player struct {
-	X     float64
-	Y     float64
-	Speed float64
+	Actor
+	Chomp      float64 // 口の開閉アニメーションの経過時間 (移動中だけ進む)
+	Controller Controller
+	Color      color.RGBA
+	Score      int
+	Lives      int // 残機 (いま遊んでいる1機を含む)。0 になったらそのプレイヤーは退場する
+	Start      Point
 }
 
-func (p *Player) Update(maze [][]int) {
-	if ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
-		newY := p.Y - p.Speed
-		if !p.isColliding(p.X, newY, maze) {
-			p.Y = newY
-		}
+func (p *Player) Alive() bool {
+	return p.Lives > 0
+}
+
+// Respawn は初期位置に戻す。
+func (p *Player) Respawn() {
+	p.X, p.Y = TileCenter(p.Start)
+	p.DirX, p.DirY = 1.0, 0.0
+	p.Chomp = 0
+	p.BeginStep()
+}
+
+func (p *Player) Update(maze [][]int, input PlayerInput, dt float64) {
+	dt = p.turnAtCenter(maze, input, dt)
+	moved := false
+	if input.Up {
+		moved = p.moveFacing(0, -1, maze, dt) || moved
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
-		newY := p.Y + p.Speed
-		if !p.isColliding(p.X, newY, maze) {
-			p.Y = newY
-		}
+	if input.Down {
+		moved = p.moveFacing(0, 1, maze, dt) || moved
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
-		newX := p.X - p.Speed
-		if !p.isColliding(newX, p.Y, maze) {
-			p.X = newX
-		}
+	if input.Left {
+		moved = p.moveFacing(-1, 0, maze, dt) || moved
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
-		newX := p.X + p.Speed
-		if !p.isColliding(newX, p.Y, maze) {
-			p.X = newX
-		}
+	if input.Right {
+		moved = p.moveFacing(1, 0, maze, dt) || moved
+	}
+	if moved {
+		p.Chomp += dt
 	}
 }
 
-func (p *Player) isColliding(x, y float64, maze [][]int) bool {
-	radius := float64(TileSize) / 3
-	
-	// プレイヤーの円の境界4点をチェック
-	checkPoints := []struct{ px, py float64 }{
-		{x - radius, y - radius}, // 左上
-		{x + radius, y - radius}, // 右上
-		{x - radius, y + radius}, // 左下
-		{x + radius, y + radius}, // 右下
+// turnAtCenter は今の向きと別の方向が押されていて、このステップでタイルの中心に届くなら、
+// 中心まで進めてそちらを向け、残りの秒数を返す。刻みの細かさで曲がる場所が変わらないようにする
+func (p *Player) turnAtCenter(maze [][]int, input PlayerInput, dt float64) float64 {
+	step := p.StepDistance(dt)
+	ahead := p.CenterAhead(p.DirX, p.DirY)
+	if step <= 0 || ahead < 0 || ahead > step {
+		return dt
 	}
-	
-	for _, point := range checkPoints {
-		tileX := int(point.px / TileSize)
-		tileY := int(point.py / TileSize)
-		
-		if tileY < 0 || tileY >= len(maze) || tileX < 0 || tileX >= len(maze[0]) {
-			return true
+	centerX, centerY := p.TileCenter()
+	for _, dir := range Directions {
+		pressed := (dir.Y < 0 && input.Up) || (dir.Y > 0 && input.Down) || (dir.X < 0 && input.Left) || (dir.X > 0 && input.Right)
+		dirX, dirY := float64(dir.X), float64(dir.Y)
+		if !pressed || (dirX == p.DirX && dirY == p.DirY) {
+			continue
 		}
-		
-		if maze[tileY][tileX] == 1 {
-			return true
+		if p.IsColliding(centerX+dirX*TileSize/2, centerY+dirY*TileSize/2, maze) {
+			continue
 		}
+		p.X, p.Y = centerX, centerY
+		p.DirX, p.DirY = dirX, dirY
+		return dt * (step - ahead) / step
 	}
-	
-	return false
+	return dt
+}
+
+// advanceToCenter は今の向きに進んでこのステップでタイルの中心に届くなら、中心で止めて残りの秒数を返す。
+// ボットが方向を決める時点を刻みの細かさによらず同じにする
+func (p *Player) advanceToCenter(dt float64) float64 {
+	step := p.StepDistance(dt)
+	ahead := p.CenterAhead(p.DirX, p.DirY)
+	if step <= 0 || ahead <= 0 || ahead > step {
+		return dt
+	}
+	p.X, p.Y = p.TileCenter()
+	p.turnHere()
+	p.Chomp += dt * ahead / step
+	return dt * (step - ahead) / step
+}
+
+// moveFacing は移動に成功したらその方向を向く。口の向きの描画に使う
+func (p *Player) moveFacing(dirX, dirY float64, maze [][]int, dt float64) bool {
+	if !p.Move(dirX, dirY, maze, dt) {
+		return false
+	}
+	p.DirX = dirX
+	p.DirY = dirY
+	return true
 }
 
 type Ghost struct {
-	X               float64
-	Y               float64
-	Speed           float64
-	DirX            float64
-	DirY            float64
+	Actor
 	State           GhostState
-	FrightenedTimer int
+	Color           color.RGBA
+	FrightenedTimer float64
 	InitialX        float64
 	InitialY        float64
+	Controller      GhostController // nil でなければ人が操作する
+	Catches         int             // プレイヤーを捕まえた回数
+	wanted          Point           // 人が最後に入れた方向。曲がれる所まで覚えておく
+	target          Point           // 最後に方向を決めたときに狙ったタイル (デバッグ表示用)
+	decision        GhostDecision   // 最後に方向を決めた理由 (デバッグ表示用)
+	decided         Point           // 最後に方向を決めたタイル
+	hasDecided      bool            // decided が有効か。巣に戻ったときなどは同じタイルでも決め直す
+	StartDir        Point           // 出発するときの向き。シードで決める
+	ReleaseDelay    float64         // 出発するまで待つ秒数。シードで決める
+	releaseTimer    float64         // 出発までの残り秒数
+	stateSince      float64         // 今の状態になった時刻 (秒)。触れた時点の状態を求めるのに使う
+	prevState       GhostState      // stateSince より前の状態
+	seed            int64           // 気まぐれに曲がるかどうかの乱数の種。シードで決める
+	turns           uint64          // 乱数を引いた回数
 }
 
-func (g *Ghost) Update(maze [][]int, playerX, playerY float64) {
+// Update は now 秒から dt 秒だけゴーストを動かす。targets はその時刻に追いかけるプレイヤーのいるタイルを返し、
+// いちばん近い相手を狙う。怯え状態が切れる時刻でステップを区切るので、刻みの細かさで動きが変わらない。
+func (g *Ghost) Update(maze [][]int, pf *Pathfinder, targets func(at float64) []Point, now, dt float64) {
 	if g.State == Frightened {
-		g.FrightenedTimer--
-		if g.FrightenedTimer <= 0 {
-			g.State = Normal
+		if g.FrightenedTimer <= dt {
+			first := max(0, g.FrightenedTimer)
+			g.move(maze, pf, targets, now, first)
+			g.FrightenedTimer = 0
+			g.setState(Normal, now+first)
+			g.move(maze, pf, targets, now+first, dt-first)
+			return
+		}
+		g.FrightenedTimer -= dt
+	}
+	g.move(maze, pf, targets, now, dt)
+}
+
+// move は状態を変えずに now 秒から dt 秒だけ動かす。目だけのゴーストは巣に着いたところで元に戻る。
+func (g *Ghost) move(maze [][]int, pf *Pathfinder, targets func(at float64) []Point, now, dt float64) {
+	if dt <= 0 {
+		return
+	}
+	if g.releaseTimer > 0 {
+		// 出発するまでは動かない。待ち終わったステップは残りの時間だけ進む
+		if g.releaseTimer >= dt {
+			g.releaseTimer -= dt
+			return
 		}
+		now += g.releaseTimer
+		dt -= g.releaseTimer
+		g.releaseTimer = 0
 	}
 	
-	newX := g.X + g.DirX*g.Speed
-	newY := g.Y + g.DirY*g.Speed
+	moveDt := dt
+	if g.State == Eaten {
+		moveDt = dt * EatenSpeedMultiplier
+	}
 	
-	if g.isColliding(newX, newY, maze) {
-		g.chooseDirection(maze, playerX, playerY)
-	} else {
-		g.X = newX
-		g.Y = newY
-		
-		if g.isAtIntersection(maze) {
-			g.chooseDirection(maze, playerX, playerY)
+	// 方向を決めるのはタイルの中心を通るときに1度だけ。中心で止めて決め、このステップの残りを新しい方向に進む。
+	// 刻みの細かさで判断の回数や場所が変わらないようにする
+	tile := g.Tile()
+	centerX, centerY := g.TileCenter()
+	step := g.StepDistance(moveDt)
+	if step > 0 && abs(g.X-centerX) <= step && abs(g.Y-centerY) <= step && (!g.hasDecided || tile != g.decided) {
+		ahead := max(0, (centerX-g.X)*g.DirX+(centerY-g.Y)*g.DirY)
+		g.X, g.Y = centerX, centerY
+		g.turnHere()
+		at := now + dt*ahead/step
+		if g.State == Eaten && tile == g.homeTile() {
+			// 巣に着いたら元に戻り、残りの時間は普通の速さで動く
+			g.setState(Normal, at)
+			g.hasDecided = false
+			g.move(maze, pf, targets, at, dt*(step-ahead)/step)
+			return
 		}
+		g.decided, g.hasDecided = tile, true
+		g.chooseDirection(pf, g.targetsAt(targets, at))
+		moveDt *= (step - ahead) / step
+	}
+	
+	if !g.Move(g.DirX, g.DirY, maze, moveDt) {
+		g.SnapToTileCenter()
+		g.chooseDirection(pf, g.targetsAt(targets, now+dt))
 	}
 }
 
-func (g *Ghost) SetFrightened() {
-	g.State = Frightened
-	g.FrightenedTimer = FrightenedDuration
+// targetsAt は at 秒の時点で狙うタイルを返す。目だけのときは巣に向かう。
+func (g *Ghost) targetsAt(targets func(at float64) []Point, at float64) []Point {
+	if g.State == Eaten {
+		return []Point{g.homeTile()}
+	}
+	return targets(at)
 }
 
-func (g *Ghost) ResetToInitialPosition() {
-	g.X = g.InitialX
-	g.Y = g.InitialY
-	g.State = Normal
+// setState は at 秒の時点で state に変える。
+func (g *Ghost) setState(state GhostState, at float64) {
+	if state == g.State {
+		return
+	}
+	g.prevState, g.State, g.stateSince = g.State, state, at
+}
+
+// stateAt は at 秒の時点の状態を返す。最後に状態が変わったより前なら、その前の状態を返す。
+func (g *Ghost) stateAt(at float64) GhostState {
+	if at < g.stateSince {
+		return g.prevState
+	}
+	return g.State
+}
+
+// random は 0 以上 1 未満の乱数を返す。ゴーストごとの種と引いた回数だけで決まるので、
+// 同じステップで何体が方向を決めても、決めた順番で結果が変わらない (splitmix64)。
+func (g *Ghost) random() float64 {
+	g.turns++
+	x := uint64(g.seed) + g.turns*0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
+
+func (g *Ghost) homeTile() Point {
+	return Point{X: int(g.InitialX / TileSize), Y: int(g.InitialY / TileSize)}
+}
+
+// SetEaten は at 秒の時点で目だけの状態にして巣へ戻らせる
+func (g *Ghost) SetEaten(at float64) {
+	g.setState(Eaten, at)
 	g.FrightenedTimer = 0
 }
 
-func (g *Ghost) isColliding(x, y float64, maze [][]int) bool {
-	radius := float64(TileSize) / 3
-	
-	checkPoints := []struct{ px, py float64 }{
-		{x - radius, y - radius},
-		{x + radius, y - radius},
-		{x - radius, y + radius},
-		{x + radius, y + radius},
+// SetFrightened は at 秒の時点で怯えさせ、残り時間を duration 秒にする
+func (g *Ghost) SetFrightened(duration, at float64) {
+	if g.State == Eaten {
+		return
 	}
-	
-	for _, point := range checkPoints {
-		tileX := int(point.px / TileSize)
-		tileY := int(point.py / TileSize)
-		
-		if tileY < 0 || tileY >= len(maze) || tileX < 0 || tileX >= len(maze[0]) {
-			return true
-		}
-		
-		if maze[tileY][tileX] == 1 {
-			return true
-		}
+	g.setState(Frightened, at)
+	g.FrightenedTimer = duration
+}
+
+func (g *Ghost) ResetToInitialPosition() {
+	g.X = g.InitialX
+	g.Y = g.InitialY
+	g.DirX = 1.0
+	g.DirY = 0.0
+	g.State, g.prevState, g.stateSince = Normal, Normal, 0
+	g.FrightenedTimer = 0
+	g.wanted = Point{}
+	g.hasDecided = false
+	if g.StartDir != (Point{}) {
+		// 最初のタイルでは方向を決め直さず、StartDir のまま出発する
+		g.DirX, g.DirY = float64(g.StartDir.X), float64(g.StartDir.Y)
+		g.decided, g.hasDecided = g.homeTile(), true
 	}
-	
-	return false
+	g.releaseTimer = g.ReleaseDelay
+	g.BeginStep()
 }
 
-func (g *Ghost) isAtIntersection(maze [][]int) bool {
-	tileX := int(g.X / TileSize)
-	tileY := int(g.Y / TileSize)
-	
-	if tileY < 0 || tileY >= len(maze) || tileX < 0 || tileX >= len(maze[0]) {
-		return false
+func (g *Ghost) chooseDirection(pf *Pathfinder, targets []Point) {
+	current := Point{X: int(g.X / TileSize), Y: int(g.Y / TileSize)}
+	if g.Controller != nil && g.State != Eaten {
+		if dir, ok := g.manualDirection(pf, current); ok {
+			g.target, g.decision = current.Add(dir), DecisionManual
+			if float64(dir.X) != g.DirX || float64(dir.Y) != g.DirY {
+				g.SnapToTileCenter()
+			}
+			g.DirX = float64(dir.X)
+			g.DirY = float64(dir.Y)
+			return
+		}
 	}
 	
-	centerX := float64(tileX*TileSize + TileSize/2)
-	centerY := float64(tileY*TileSize + TileSize/2)
+	var validDirections []Point
 	
-	if abs(g.X-centerX) < 5 && abs(g.Y-centerY) < 5 {
-		directions := [][]float64{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-		validDirections := 0
-		
-		for _, dir := range directions {
-			nextTileX := tileX + int(dir[0])
-			nextTileY := tileY + int(dir[1])
-			
-			if nextTileY >= 0 && nextTileY < len(maze) && nextTileX >= 0 && nextTileX < len(maze[0]) {
-				if maze[nextTileY][nextTileX] != 1 {
-					validDirections++
-				}
+	for _, dir := range Directions {
+		if _, ok := pf.Step(current, dir); ok {
+			if float64(dir.X) != -g.DirX || float64(dir.Y) != -g.DirY {
+				validDirections = append(validDirections, dir)
 			}
 		}
-		
-		return validDirections > 2
+	}
+	// 行き止まりでは引き返すしかない
+	if reverse := (Point{X: int(-g.DirX), Y: int(-g.DirY)}); len(validDirections) == 0 {
+		if _, ok := pf.Step(current, reverse); ok {
+			validDirections = append(validDirections, reverse)
+		}
 	}
 	
-	return false
-}
-
-func (g *Ghost) chooseDirection(maze [][]int, playerX, playerY float64) {
-	tileX := int(g.X / TileSize)
-	tileY := int(g.Y / TileSize)
-	
-	directions := [][]float64{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-	var validDirections [][]float64
-	
-	for _, dir := range directions {
-		nextTileX := tileX + int(dir[0])
-		nextTileY := tileY + int(dir[1])
-		
-		if nextTileY >= 0 && nextTileY < len(maze) && nextTileX >= 0 && nextTileX < len(maze[0]) {
-			if maze[nextTileY][nextTileX] != 1 {
-				if dir[0] != -g.DirX || dir[1] != -g.DirY {
-					validDirections = append(validDirections, dir)
-				}
-			}
+	if g.State == Normal && len(validDirections) > 1 && g.random() < GhostWanderChance {
+		chosen := validDirections[int(g.random()*float64(len(validDirections)))]
+		g.target, g.decision = current.Add(chosen), DecisionRandom
+		if float64(chosen.X) != g.DirX || float64(chosen.Y) != g.DirY {
+			g.SnapToTileCenter()
 		}
+		g.DirX = float64(chosen.X)
+		g.DirY = float64(chosen.Y)
+		return
 	}
 	
 	if len(validDirections) > 0 {
-		var bestDirection []float64
-		var bestDistance float64
-		
-		if g.State == Frightened {
-			bestDistance = -1
-		} else {
-			bestDistance = float64(999999)
+		g.target, g.decision = nearestTarget(pf, current, targets), DecisionChase
+		switch g.State {
+		case Frightened:
+			g.decision = DecisionFlee
+		case Eaten:
+			g.decision = DecisionHome
 		}
 		
-		for _, dir := range validDirections {
-			nextX := g.X + dir[0]*TileSize
-			nextY := g.Y + dir[1]*TileSize
-			
-			dx := nextX - playerX
-			dy := nextY - playerY
-			distance := dx*dx + dy*dy
+		var bestDirection *Point
+		var bestDistance int
+		
+		// 壁越しの直線距離ではなく、迷路上の実際の歩数で比較する
+		for i, dir := range validDirections {
+			next, _ := pf.Step(current, dir)
+			distance := nearestDistance(pf, next, targets)
+			if distance < 0 {
+				continue
+			}
 			
 			if g.State == Frightened {
-				if distance > bestDistance {
+				if bestDirection == nil || distance > bestDistance {
 					bestDistance = distance
-					bestDirection = dir
+					bestDirection = &validDirections[i]
 				}
 			} else {
-				if distance < bestDistance {
+				if bestDirection == nil || distance < bestDistance {
 					bestDistance = distance
-					bestDirection = dir
+					bestDirection = &validDirections[i]
 				}
 			}
 		}
 		
 		if bestDirection != nil {
-			g.DirX = bestDirection[0]
-			g.DirY = bestDirection[1]
+			if float64(bestDirection.X) != g.DirX || float64(bestDirection.Y) != g.DirY {
+				g.SnapToTileCenter()
+			}
+			g.DirX = float64(bestDirection.X)
+			g.DirY = float64(bestDirection.Y)
 		} else {
-			chosen := validDirections[rand.Intn(len(validDirections))]
-			g.DirX = chosen[0]
-			g.DirY = chosen[1]
+			chosen := validDirections[int(g.random()*float64(len(validDirections)))]
+			g.target, g.decision = current.Add(chosen), DecisionRandom
+			g.DirX = float64(chosen.X)
+			g.DirY = float64(chosen.Y)
+		}
+	}
+}
+
+// steer は人の入力を受け取る。押された方向は、曲がれる分かれ道に着くまで覚えておく。
+func (g *Ghost) steer(input PlayerInput) {
+	forward := Point{X: int(g.DirX), Y: int(g.DirY)}
+	for _, dir := range Directions {
+		pressed := (dir.Y < 0 && input.Up) || (dir.Y > 0 && input.Down) || (dir.X < 0 && input.Left) || (dir.X > 0 && input.Right)
+		if pressed {
+			g.wanted = dir
+			if dir != forward {
+				// 今の向きと別の方向も押されていれば、そちらへ曲がりたいものとみなす
+				return
+			}
+		}
+	}
+}
+
+// manualDirection は人が操作するゴーストの進む方向を返す。AI と同じく引き返せない。
+// 入れた方向に進めなければまっすぐ進み、それもできない (角や行き止まり) ときは false を返して AI に任せる。
+func (g *Ghost) manualDirection(pf *Pathfinder, current Point) (Point, bool) {
+	forward := Point{X: int(g.DirX), Y: int(g.DirY)}
+	reverse := Point{X: -forward.X, Y: -forward.Y}
+	for _, dir := range []Point{g.wanted, forward} {
+		if dir == (Point{}) || dir == reverse {
+			continue
+		}
+		if _, ok := pf.Step(current, dir); ok {
+			return dir, true
+		}
+	}
+	return Point{}, false
+}
+
+// nearestDistance は from から targets のうちいちばん近いタイルまでの歩数を返す。どこにも行けなければ -1。
+func nearestDistance(pf *Pathfinder, from Point, targets []Point) int {
+	nearest := -1
+	for _, target := range targets {
+		if d := pf.Distance(from, target); d >= 0 && (nearest < 0 || d < nearest) {
+			nearest = d
+		}
+	}
+	return nearest
+}
+
+// nearestTarget は targets のうち from からいちばん近いタイルを返す。どこにも行けなければ from。
+func nearestTarget(pf *Pathfinder, from Point, targets []Point) Point {
+	nearest, best := from, -1
+	for _, target := range targets {
+		if d := pf.Distance(from, target); d >= 0 && (best < 0 || d < best) {
+			nearest, best = target, d
 		}
 	}
+	return nearest
 }
 
 func abs(x float64) float64 {
@@ -261,265 +447,701 @@ type Scene interface {
 }
 
 type GameScene struct {
-	maze   [][]int
-	player Player
-	ghost  Ghost
-	Score  int
+	maze       [][]int
+	ghostPaths *Pathfinder
+	players    []*Player
+	ghosts     []*Ghost
+	Score      int // 全員のスコアの合計
+	// 残りのドットとパワークッキーの数。取得のたびに減らすので毎フレーム迷路を走査しなくてよい
+	dotsRemaining      int
+	totalDots          int
+	renderer           *MazeRenderer
+	camera             *Camera
+	minimap            *Minimap
+	showMinimap        bool
+	level              int
+	clock              *FixedStep
+	alpha              float64
+	elapsed            float64 // シミュレーション開始からの経過時間 (秒)
+	stepStart          float64 // 進めているステップの始まりの時刻 (秒)
+	ghostsAt           float64 // ゴーストを進めた時刻 (秒)。ステップの途中でパワークッキーを食べたら、そこで区切って進める
+	rng                *rand.Rand
+	rngSource          *countingSource // rng の元。巻き戻しのために引いた回数を数える
+	sound              *SoundManager // nil の場合は音を鳴らさない
+	assist             *Autopilot // nil でなければ1人目を Controller の代わりに自動操縦で動かす
+	allowAssist        bool       // A キーでアシストを切り替えられる。1人用の通常のゲームだけ立てる
+	demo               bool       // アトラクトモードのデモ。キーを押すか決着がつくと exit に戻る
+	stats              GameStats
+	hud                func(screen *ebiten.Image) // nil でなければスコア表示の代わりに呼ぶ
+	frightenedDuration float64
+	started            bool
+	exit               func() Scene // ゲームを抜けたときの行き先。nil の場合は結果画面のままにする
+	debugger           *Debugger    // nil でなければ開発者モード。シミュレーションは Debugger が進める
+	events             *EventBus    // ルールの処理で起きた出来事の発行先
+	telemetry          *TelemetryLog // nil なら記録しない
+	popups             []scorePopup
+}
+
+// GameStats はゲーム開始からの累計。
+type GameStats struct {
+	DotsEaten    int
+	PelletsEaten int
+	GhostsEaten  int
+}
+
+type GameConfig struct {
+	SimulationRate int
+	Seed           int64
+	Sound          *SoundManager // nil なら無音
+	Players        int           // 同時に遊ぶ人数。0 なら1人
+	Lives          int           // 1人あたりの残機。0 なら1 (捕まったら終わり)
+	Controllers    []Controller  // プレイヤーごとの操作。足りない分はキーボード (DefaultKeyBindings)
+	// n 番目のゴーストを人が操作するときの操作。nil の要素と足りない分は AI が動かす
+	GhostControllers []GhostController
+
+	// 0 の場合はそれぞれ PlayerSpeed, GhostSpeed, FrightenedDuration を使う
+	PlayerSpeed        float64
+	GhostSpeed         float64
+	FrightenedDuration float64
+	
+	TelemetryDir string // 空でなければ、ゲームごとの記録 (JSON Lines) をこのディレクトリに書く
+}
+
+// withDefaults は未設定の項目を既定値で埋めた設定を返す。
+func (c GameConfig) withDefaults() GameConfig {
+	if c.SimulationRate <= 0 {
+		c.SimulationRate = DefaultSimulationRate
+	}
+	if c.Players <= 0 {
+		c.Players = 1
+	}
+	if c.Lives <= 0 {
+		c.Lives = 1
+	}
+	controllers := make([]Controller, c.Players)
+	for i := range controllers {
+		if i < len(c.Controllers) && c.Controllers[i] != nil {
+			controllers[i] = c.Controllers[i]
+		} else {
+			controllers[i] = NewKeyboardController(DefaultKeyBindings[i%len(DefaultKeyBindings)], i+1)
+		}
+	}
+	c.Controllers = controllers
+	if c.PlayerSpeed <= 0 {
+		c.PlayerSpeed = PlayerSpeed
+	}
+	if c.GhostSpeed <= 0 {
+		c.GhostSpeed = GhostSpeed
+	}
+	if c.FrightenedDuration <= 0 {
+		c.FrightenedDuration = FrightenedDuration
+	}
+	return c
+}
+
+// ゴーストの色 (出現順)
+var ghostColors = []color.RGBA{
+	{R: 255, G: 0, B: 0, A: 255},
+	{R: 255, G: 184, B: 255, A: 255},
+	{R: 0, G: 255, B: 255, A: 255},
+	{R: 255, G: 184, B: 82, A: 255},
+}
+
+func NewGameScene(maze *Maze, config GameConfig) *GameScene {
+	config = config.withDefaults()
+	gs := &GameScene{
+		maze:               maze.CloneTiles(),
+		clock:              NewFixedStep(config.SimulationRate),
+		sound:              config.Sound,
+		frightenedDuration: config.FrightenedDuration,
+		level:              1,
+	}
+	
+	gs.rngSource = newCountingSource(config.Seed)
+	gs.rng = rand.New(gs.rngSource)
+	
+	for i := 0; i < config.Players; i++ {
+		player := &Player{
+			Actor:      Actor{Speed: config.PlayerSpeed},
+			Controller: config.Controllers[i],
+			Color:      PlayerColors[i%len(PlayerColors)],
+			Lives:      config.Lives,
+			Start:      maze.PlayerStart,
+		}
+		player.Respawn()
+		gs.players = append(gs.players, player)
+	}
+	
+	for i, start := range maze.GhostStarts {
+		x, y := TileCenter(start)
+		ghost := &Ghost{
+			Actor: Actor{
+				X:           x,
+				Y:           y,
+				Speed:       config.GhostSpeed,
+				DirX:        1.0,
+				DirY:        0.0,
+				CanUseDoors: true,
+			},
+			State:    Normal,
+			Color:    ghostColors[i%len(ghostColors)],
+			InitialX: x,
+			InitialY: y,
+		}
+		if i < len(config.GhostControllers) {
+			ghost.Controller = config.GhostControllers[i]
+		}
+		ghost.BeginStep()
+		gs.ghosts = append(gs.ghosts, ghost)
+	}
+	
+	gs.dotsRemaining = countDots(gs.maze)
+	gs.totalDots = gs.dotsRemaining
+	gs.renderer = NewMazeRenderer(WallColorForLevel(gs.level))
+	
+	viewW, viewH := ScreenSize()
+	gs.camera = NewCamera()
+	focusX, focusY := gs.cameraFocus()
+	gs.camera.CenterOn(focusX, focusY, gs.worldWidth(), gs.worldHeight(), float64(viewW), float64(viewH))
+	gs.minimap = NewMinimap(gs.maze, viewW, viewH)
+	gs.showMinimap = !MazeFitsScreen(gs.maze)
+	gs.ghostPaths = NewPathfinder(gs.maze, true)
+	gs.ghostPaths.Precompute()
+	
+	for _, ghost := range gs.ghosts {
+		start := ghost.homeTile()
+		var open []Point
+		for _, dir := range Directions {
+			if _, ok := gs.ghostPaths.Step(start, dir); ok {
+				open = append(open, dir)
+			}
+		}
+		if len(open) > 0 {
+			ghost.StartDir = open[gs.rng.Intn(len(open))]
+		}
+		ghost.ReleaseDelay = gs.rng.Float64() * GhostReleaseJitter
+		ghost.seed = gs.rng.Int63()
+		ghost.ResetToInitialPosition()
+	}
+	
+	gs.events = NewEventBus()
+	gs.events.Subscribe(gs.recordStats)
+	gs.events.Subscribe(gs.playSounds)
+	gs.events.Subscribe(gs.showScorePopups)
+	if config.TelemetryDir != "" {
+		telemetry, err := NewTelemetryLog(config.TelemetryDir, gs, config.Seed)
+		if err != nil {
+			log.Printf("telemetry: %v", err)
+		}
+		gs.telemetry = telemetry
+	}
+	return gs
 }
 
 func (gs *GameScene) Update() Scene {
-	gs.player.Update(gs.maze)
-	gs.ghost.Update(gs.maze, gs.player.X, gs.player.Y)
-	gs.checkItemCollection()
+	gs.handleSoundKeys()
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		gs.showMinimap = !gs.showMinimap
+	}
+	if gs.exit != nil && inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		gs.telemetry.Abort(OutcomeQuit)
+		gs.sound.StopAll()
+		return gs.exit()
+	}
+	if gs.demo && (len(inpututil.AppendJustPressedKeys(nil)) > 0 || inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft)) {
+		gs.telemetry.Abort(OutcomeQuit)
+		return gs.exit()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF4) {
+		if gs.debugger == nil {
+			gs.debugger = NewDebugger(gs)
+		} else {
+			gs.debugger = nil
+			gs.clock.Reset()
+		}
+	}
+	// 同時プレイや対戦では A キーを2人目が使うので、アシストは1人用のゲームだけ
+	if gs.allowAssist && inpututil.IsKeyJustPressed(ebiten.KeyA) {
+		if gs.assist == nil {
+			gs.assist = NewAutopilot()
+		} else {
+			gs.assist = nil
+		}
+	}
+	if !gs.started {
+		gs.started = true
+		gs.sound.Play(SoundIntro)
+	}
+	
+	if gs.debugger != nil {
+		return gs.debugger.Update()
+	}
+	
+	var next Scene = gs
+	gs.alpha = gs.clock.Advance(func(dt float64) bool {
+		next = gs.Step(dt)
+		return next == gs
+	})
+	if gs.demo && next != Scene(gs) {
+		return gs.exit()
+	}
+	return next
+}
+
+// Step はシミュレーションを dt 秒だけ進める。同じ初期状態・乱数シード・入力からは常に同じ結果になる。
+func (gs *GameScene) Step(dt float64) Scene {
+	gs.stepStart, gs.ghostsAt = gs.elapsed, gs.elapsed
+	gs.elapsed += dt
+	for i, player := range gs.players {
+		if !player.Alive() {
+			continue
+		}
+		player.BeginStep()
+		controller := player.Controller
+		if i == 0 && gs.assist != nil {
+			controller = gs.assist
+		}
+		playerDt := dt
+		if _, ok := controller.(centerSteered); ok {
+			// タイルごとに方向を決めるボットには、中心に着いた時点の状態を見せる
+			playerDt = player.advanceToCenter(dt)
+		}
+		player.Update(gs.maze, controller.Input(gs, player, playerDt), playerDt)
+	}
+	viewW, viewH := ScreenSize()
+	focusX, focusY := gs.cameraFocus()
+	gs.camera.Follow(focusX, focusY, gs.worldWidth(), gs.worldHeight(), float64(viewW), float64(viewH), dt)
+	for _, ghost := range gs.ghosts {
+		ghost.BeginStep()
+		if ghost.Controller != nil {
+			ghost.steer(ghost.Controller.GhostInput(gs, ghost, dt))
+		}
+	}
+	// パワークッキーを食べた時刻からゴーストは怯えるので、そこまで進めてから食べる
+	if player, at, ok := gs.firstPellet(); ok {
+		gs.moveGhosts(at)
+		if !gs.touchedBefore(player, at) {
+			gs.collectItem(player)
+		}
+	}
+	gs.moveGhosts(gs.elapsed)
+	gs.telemetry.Sample()
+	late := gs.checkItemCollection()
+	
+	gs.updateAmbience()
 	
 	if gs.checkPlayerGhostCollision() {
-		return &GameOverScene{}
+		gs.events.Publish(GameOver{Level: gs.level, Score: gs.Score})
+		return &GameOverScene{next: gs.exit}
+	}
+	for _, player := range late {
+		if player.Alive() {
+			gs.collectItem(player)
+		}
 	}
 	
 	if gs.checkStageClear() {
-		return &StageClearScene{}
+		gs.events.Publish(LevelCleared{Level: gs.level, Score: gs.Score})
+		return &StageClearScene{next: gs.exit}
 	}
 	
 	return gs
 }
 
-func (gs *GameScene) checkItemCollection() {
-	tileX := int(gs.player.X / TileSize)
-	tileY := int(gs.player.Y / TileSize)
+// moveGhosts はゴーストを until 秒まで進める。
+func (gs *GameScene) moveGhosts(until float64) {
+	for _, ghost := range gs.ghosts {
+		ghost.Update(gs.maze, gs.ghostPaths, gs.playerTilesAt, gs.ghostsAt, until-gs.ghostsAt)
+	}
+	gs.ghostsAt = until
+}
+
+// stepFraction は進めているステップの中の at 秒の時点を、ステップの始めを 0、終わりを 1 とした割合で返す。
+func (gs *GameScene) stepFraction(at float64) float64 {
+	if gs.elapsed <= gs.stepStart {
+		return 1
+	}
+	return min(1, max(0, (at-gs.stepStart)/(gs.elapsed-gs.stepStart)))
+}
+
+// stepTime は進めているステップの中の割合 s の時点の時刻 (秒) を返す。
+func (gs *GameScene) stepTime(s float64) float64 {
+	return gs.stepStart + s*(gs.elapsed-gs.stepStart)
+}
+
+// playerTilesAt はゴーストが狙う、生きているプレイヤーのいるタイルを at 秒の時点で返す。
+// プレイヤーはゴーストより先にステップの終わりまで進んでいるので、ステップの途中の位置に戻して見る。
+func (gs *GameScene) playerTilesAt(at float64) []Point {
+	var tiles []Point
+	for _, player := range gs.players {
+		if !player.Alive() {
+			continue
+		}
+		if player.warped() {
+			tiles = append(tiles, player.Tile())
+			continue
+		}
+		x, y := player.positionAt(gs.stepFraction(at))
+		tiles = append(tiles, Point{X: int(x / TileSize), Y: int(y / TileSize)})
+	}
+	return tiles
+}
+
+// firstPellet はこのステップでパワークッキーのタイルに入ったプレイヤーのうち、いちばん早く入ったものとその時刻を返す。
+func (gs *GameScene) firstPellet() (*Player, float64, bool) {
+	var first *Player
+	firstAt := 0.0
+	for _, player := range gs.players {
+		if !player.Alive() {
+			continue
+		}
+		tile := player.Tile()
+		if gs.maze[tile.Y][tile.X] != TilePellet {
+			continue
+		}
+		s := player.EnteredTileAt()
+		if s <= 0 {
+			continue
+		}
+		if at := gs.stepTime(s); first == nil || at < firstAt {
+			first, firstAt = player, at
+		}
+	}
+	return first, firstAt, first != nil
+}
+
+// touchedBefore は player が at 秒までに目だけでないゴーストに触れたかどうかを返す。ゴーストは at 秒まで進めてあること。
+func (gs *GameScene) touchedBefore(player *Player, at float64) bool {
+	partial := player.Actor
+	partial.X, partial.Y = player.positionAt(gs.stepFraction(at))
+	for _, ghost := range gs.ghosts {
+		if _, ok := partial.ContactTime(&ghost.Actor); ok && ghost.State != Eaten {
+			return true
+		}
+	}
+	return false
+}
+
+// cameraFocus はカメラが追う位置を返す。複数人のときは生きているプレイヤーの中間にする。
+func (gs *GameScene) cameraFocus() (float64, float64) {
+	x, y, n := 0.0, 0.0, 0
+	for _, player := range gs.players {
+		if player.Alive() {
+			x += player.X
+			y += player.Y
+			n++
+		}
+	}
+	if n == 0 {
+		return gs.players[0].X, gs.players[0].Y
+	}
+	return x / float64(n), y / float64(n)
+}
+
+// updateAmbience は状況に応じて背景音を切り替える。
+// 目が巣に戻っている間は専用の音、イジケ状態の間はパワークッキーの音、それ以外は残りドット数に応じたサイレン。
+func (gs *GameScene) updateAmbience() {
+	if gs.sound.IsPlaying(SoundIntro) {
+		return
+	}
+	switch {
+	case gs.anyGhostIn(Eaten):
+		gs.sound.PlayLoop(SoundEyes)
+	case gs.anyGhostIn(Frightened):
+		gs.sound.PlayLoop(SoundPowerPellet)
+	default:
+		gs.sound.PlayLoop(SirenForProgress(gs.dotsRemaining, gs.totalDots))
+	}
+}
+
+func (gs *GameScene) worldWidth() float64 {
+	return float64(len(gs.maze[0]) * TileSize)
+}
+
+func (gs *GameScene) worldHeight() float64 {
+	return float64(len(gs.maze) * TileSize)
+}
+
+func (gs *GameScene) anyGhostIn(state GhostState) bool {
+	for _, ghost := range gs.ghosts {
+		if ghost.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+// ResetPositions はミスの後、ドットは食べたままでプレイヤーとゴーストを初期位置に戻す。
+func (gs *GameScene) ResetPositions() {
+	for _, player := range gs.players {
+		player.Respawn()
+	}
+	for _, ghost := range gs.ghosts {
+		ghost.ResetToInitialPosition()
+	}
+	if gs.assist != nil {
+		gs.assist = NewAutopilot()
+	}
+	viewW, viewH := ScreenSize()
+	focusX, focusY := gs.cameraFocus()
+	gs.camera.CenterOn(focusX, focusY, gs.worldWidth(), gs.worldHeight(), float64(viewW), float64(viewH))
+	gs.clock.Reset()
+}
+
+// SetLevel は面数を設定し、壁の色をその面のものにする。
+func (gs *GameScene) SetLevel(level int) {
+	gs.level = level
+	gs.renderer.SetWallColor(WallColorForLevel(level))
+}
+
+// handleSoundKeys は M でミュート切り替え、-/= で音量を調整する
+func (gs *GameScene) handleSoundKeys() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+		gs.sound.ToggleMute()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyMinus) {
+		gs.sound.SetVolume(gs.sound.Volume() - 0.1)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEqual) {
+		gs.sound.SetVolume(gs.sound.Volume() + 0.1)
+	}
+}
+
+// checkItemCollection は生きているプレイヤーの入ったタイルのドットやパワークッキーを食べる。
+// このステップでゴーストに触れてからタイルに入ったプレイヤーは食べずに返すので、当たり判定のあとで食べる。
+func (gs *GameScene) checkItemCollection() []*Player {
+	var late []*Player
+	for _, player := range gs.players {
+		if !player.Alive() {
+			continue
+		}
+		if _, at, ok := gs.firstContact(player, 0); ok && player.EnteredTileAt() > at {
+			late = append(late, player)
+			continue
+		}
+		gs.collectItem(player)
+	}
+	return late
+}
+
+// collectItem は player のいるタイルのドットやパワークッキーを食べる。パワークッキーは全員のためにゴーストを怯えさせる。
+func (gs *GameScene) collectItem(player *Player) {
+	tileX := int(player.X / TileSize)
+	tileY := int(player.Y / TileSize)
 	
 	if tileY >= 0 && tileY < len(gs.maze) && tileX >= 0 && tileX < len(gs.maze[0]) {
-		if gs.maze[tileY][tileX] == 2 {
-			gs.maze[tileY][tileX] = 0
-			gs.Score += 10
-		} else if gs.maze[tileY][tileX] == 3 {
-			gs.maze[tileY][tileX] = 0
-			gs.Score += 50
-			gs.ghost.SetFrightened()
+		tile := Point{X: tileX, Y: tileY}
+		if gs.maze[tileY][tileX] == TileDot {
+			gs.maze[tileY][tileX] = TileEmpty
+			gs.addScore(player, 10)
+			gs.dotsRemaining--
+			gs.renderer.InvalidateDotAt(tileX, tileY)
+			gs.minimap.SetTile(tileX, tileY, TileEmpty)
+			gs.events.Publish(DotEaten{Player: gs.playerIndex(player), Tile: tile, Points: 10})
+		} else if gs.maze[tileY][tileX] == TilePellet {
+			gs.maze[tileY][tileX] = TileEmpty
+			gs.addScore(player, 50)
+			gs.dotsRemaining--
+			gs.renderer.InvalidateDotAt(tileX, tileY)
+			gs.minimap.SetTile(tileX, tileY, TileEmpty)
+			// 怯えるのはタイルに入った時刻から。ゴーストをそれより先まで進めてあれば、その分だけ短くする
+			at := gs.stepTime(player.EnteredTileAt())
+			for _, ghost := range gs.ghosts {
+				ghost.SetFrightened(gs.frightenedDuration-max(0, gs.ghostsAt-at), at)
+			}
+			gs.events.Publish(PelletEaten{Player: gs.playerIndex(player), Tile: tile, Points: 50})
 		}
 	}
 }
 
+// playerIndex は player の gs.players での添字を返す。
+func (gs *GameScene) playerIndex(player *Player) int {
+	for i, p := range gs.players {
+		if p == player {
+			return i
+		}
+	}
+	return -1
+}
+
+func (gs *GameScene) addScore(player *Player, points int) {
+	player.Score += points
+	gs.Score += points
+}
+
+// checkPlayerGhostCollision はゴーストに捕まったプレイヤーの残機を減らし、全員いなくなったら true を返す。
+// 残機のあるプレイヤーは初期位置からやり直す。
 func (gs *GameScene) checkPlayerGhostCollision() bool {
-	playerRadius := float64(TileSize) / 3
-	ghostRadius := float64(TileSize) / 3
-	
-	dx := gs.player.X - gs.ghost.X
-	dy := gs.player.Y - gs.ghost.Y
-	distance := dx*dx + dy*dy
-	
-	if distance < (playerRadius+ghostRadius)*(playerRadius+ghostRadius) {
-		if gs.ghost.State == Frightened {
-			gs.ghost.ResetToInitialPosition()
-			gs.Score += 200
+	for i, player := range gs.players {
+		if !player.Alive() {
+			continue
+		}
+		ghost, ok := gs.caught(player)
+		if !ok {
+			continue
+		}
+		player.Lives--
+		gs.events.Publish(PlayerDied{Player: i, Ghost: ghost, LivesLeft: player.Lives})
+		if !player.Alive() {
+			continue
+		}
+		player.Respawn()
+		if len(gs.players) == 1 {
+			// 1人のときはアーケードと同じく、ゴーストも巣からやり直す
+			for _, ghost := range gs.ghosts {
+				ghost.ResetToInitialPosition()
+			}
+		}
+	}
+	for _, player := range gs.players {
+		if player.Alive() {
 			return false
-		} else {
-			return true
 		}
 	}
-	
-	return false
+	return true
 }
 
-func (gs *GameScene) checkStageClear() bool {
-	for _, row := range gs.maze {
-		for _, tile := range row {
-			if tile == 2 || tile == 3 {
-				return false
+// caught は player が怯えていないゴーストに触れたかどうかと、そのゴーストの添字を返す。
+// このステップで触れたゴーストを触れた順に見て、触れた時点で怯えていたゴーストは食べる。捕まったプレイヤーは触れた位置で止める。
+func (gs *GameScene) caught(player *Player) (int, bool) {
+	after := 0.0
+	for {
+		i, s, ok := gs.firstContact(player, after)
+		if !ok {
+			return -1, false
+		}
+		ghost := gs.ghosts[i]
+		at := gs.stepTime(s)
+		if ghost.stateAt(at) == Frightened {
+			ghost.SetEaten(at)
+			x, y := ghost.X, ghost.Y
+			if !ghost.warped() {
+				x, y = ghost.positionAt(s)
+			}
+			gs.addScore(player, 200)
+			gs.events.Publish(GhostEaten{Player: gs.playerIndex(player), Ghost: i, X: x, Y: y, Points: 200})
+			// 目は食べられた位置から、ステップの残りの時間だけ進む。向きを変えるのは次のタイルの中心
+			if !ghost.warped() {
+				ghost.X, ghost.Y = x, y
+				ghost.turnHere()
+				ghost.Update(gs.maze, gs.ghostPaths, gs.playerTilesAt, at, gs.elapsed-at)
 			}
+			after = s
+			continue
 		}
+		ghost.Catches++
+		player.X, player.Y = player.positionAt(s)
+		return i, true
 	}
-	return true
+}
+
+// firstContact は触れた時点で目だけでなかったゴーストのうち、このステップの割合 after 以降で player に最初に触れたものの添字と、
+// 触れた時点 (ステップの始めを 0、終わりを 1 とした割合) を返す。
+func (gs *GameScene) firstContact(player *Player, after float64) (int, float64, bool) {
+	first, firstAt := -1, 0.0
+	for i, ghost := range gs.ghosts {
+		at, ok := player.ContactTime(&ghost.Actor)
+		if !ok || at < after || ghost.stateAt(gs.stepTime(at)) == Eaten {
+			continue
+		}
+		if first < 0 || at < firstAt {
+			first, firstAt = i, at
+		}
+	}
+	return first, firstAt, first >= 0
+}
+
+func (gs *GameScene) checkStageClear() bool {
+	return gs.dotsRemaining == 0
 }
 
 func (gs *GameScene) Draw(screen *ebiten.Image) {
-	for y, row := range gs.maze {
-		for x, tile := range row {
-			switch tile {
-			case 1:
-				vector.DrawFilledRect(screen, float32(x*TileSize), float32(y*TileSize), TileSize, TileSize, color.RGBA{R: 0, G: 0, B: 255, A: 255}, false)
-			case 2:
-				centerX := float32(x*TileSize + TileSize/2)
-				centerY := float32(y*TileSize + TileSize/2)
-				vector.DrawFilledCircle(screen, centerX, centerY, 2, color.RGBA{R: 255, G: 255, B: 255, A: 255}, false)
-			case 3:
-				centerX := float32(x*TileSize + TileSize/2)
-				centerY := float32(y*TileSize + TileSize/2)
-				vector.DrawFilledCircle(screen, centerX, centerY, 5, color.RGBA{R: 255, G: 255, B: 255, A: 255}, false)
-			}
+	cameraX, cameraY := gs.camera.RenderPosition(gs.alpha)
+	viewW, viewH := float64(screen.Bounds().Dx()), float64(screen.Bounds().Dy())
+	gs.renderer.Draw(screen, gs.maze, cameraX, cameraY)
+	
+	for _, player := range gs.players {
+		if !player.Alive() {
+			continue
+		}
+		playerX, playerY := player.RenderPosition(gs.alpha)
+		drawPlayer(screen, playerX-cameraX, playerY-cameraY, player.DirX, player.DirY, player.Chomp, player.Color)
+	}
+	
+	for _, ghost := range gs.ghosts {
+		ghostX, ghostY := ghost.RenderPosition(gs.alpha)
+		if !isOnScreen(ghostX, ghostY, TileSize, cameraX, cameraY, viewW, viewH) {
+			continue
+		}
+		drawGhost(screen, ghost, ghostX-cameraX, ghostY-cameraY, gs.elapsed)
+		if ghost.Controller != nil && ghost.State != Eaten {
+			// 人が操作しているゴーストは輪で囲んで見分けられるようにする
+			vector.StrokeCircle(screen, float32(ghostX-cameraX), float32(ghostY-cameraY), float32(ActorRadius+4), 2, EyeWhiteColor, true)
 		}
 	}
 	
-	vector.DrawFilledCircle(screen, float32(gs.player.X), float32(gs.player.Y), TileSize/3, color.RGBA{R: 0xff, G: 0xff, B: 0, A: 0xff}, false)
+	gs.drawScorePopups(screen, cameraX, cameraY)
 	
-	var ghostColor color.RGBA
-	if gs.ghost.State == Frightened {
-		ghostColor = color.RGBA{R: 0, G: 0, B: 255, A: 255}
-	} else {
-		ghostColor = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+	if debugOverlay {
+		gs.drawDebug(screen, cameraX, cameraY)
 	}
-	vector.DrawFilledCircle(screen, float32(gs.ghost.X), float32(gs.ghost.Y), TileSize/3, ghostColor, false)
 	
-	gs.drawScore(screen)
+	if gs.showMinimap {
+		gs.minimap.Draw(screen, gs.players, gs.ghosts, cameraX, cameraY)
+	}
+	if gs.hud != nil {
+		gs.hud(screen)
+	} else {
+		gs.drawScore(screen)
+	}
+	if gs.debugger != nil {
+		gs.debugger.Draw(screen)
+	}
 }
 
 func (gs *GameScene) drawScore(screen *ebiten.Image) {
+	if len(gs.players) > 1 {
+		gs.drawPlayerScores(screen)
+		return
+	}
 	scoreText := fmt.Sprintf("SCORE: %d", gs.Score)
-	
-	pixelSize := float32(2)
-	letterSpacing := float32(12)
-	startX := float32(10)
-	startY := float32(10)
-	
-	letterPatterns := map[rune][][]bool{
-		'S': {
-			{false, true, true, true, false},
-			{true, false, false, false, false},
-			{false, true, true, true, false},
-			{false, false, false, false, true},
-			{true, true, true, true, false},
-		},
-		'C': {
-			{false, true, true, true, false},
-			{true, false, false, false, false},
-			{true, false, false, false, false},
-			{true, false, false, false, false},
-			{false, true, true, true, false},
-		},
-		'O': {
-			{false, true, true, true, false},
-			{true, false, false, false, true},
-			{true, false, false, false, true},
-			{true, false, false, false, true},
-			{false, true, true, true, false},
-		},
-		'R': {
-			{true, true, true, true, false},
-			{true, false, false, false, true},
-			{true, true, true, true, false},
-			{true, false, false, true, false},
-			{true, false, false, false, true},
-		},
-		'E': {
-			{true, true, true, true, true},
-			{true, false, false, false, false},
-			{true, true, true, true, false},
-			{true, false, false, false, false},
-			{true, true, true, true, true},
-		},
-		':': {
-			{false, false, false, false, false},
-			{false, true, false, false, false},
-			{false, false, false, false, false},
-			{false, true, false, false, false},
-			{false, false, false, false, false},
-		},
-		' ': {
-			{false, false, false, false, false},
-			{false, false, false, false, false},
-			{false, false, false, false, false},
-			{false, false, false, false, false},
-			{false, false, false, false, false},
-		},
-		'0': {
-			{false, true, true, true, false},
-			{true, false, false, false, true},
-			{true, false, false, false, true},
-			{true, false, false, false, true},
-			{false, true, true, true, false},
-		},
-		'1': {
-			{false, false, true, false, false},
-			{false, true, true, false, false},
-			{false, false, true, false, false},
-			{false, false, true, false, false},
-			{false, true, true, true, false},
-		},
-		'2': {
-			{false, true, true, true, false},
-			{false, false, false, false, true},
-			{false, true, true, true, false},
-			{true, false, false, false, false},
-			{true, true, true, true, true},
-		},
-		'3': {
-			{true, true, true, true, false},
-			{false, false, false, false, true},
-			{false, true, true, true, false},
-			{false, false, false, false, true},
-			{true, true, true, true, false},
-		},
-		'4': {
-			{true, false, false, false, true},
-			{true, false, false, false, true},
-			{true, true, true, true, true},
-			{false, false, false, false, true},
-			{false, false, false, false, true},
-		},
-		'5': {
-			{true, true, true, true, true},
-			{true, false, false, false, false},
-			{true, true, true, true, false},
-			{false, false, false, false, true},
-			{true, true, true, true, false},
-		},
-		'6': {
-			{false, true, true, true, false},
-			{true, false, false, false, false},
-			{true, true, true, true, false},
-			{true, false, false, false, true},
-			{false, true, true, true, false},
-		},
-		'7': {
-			{true, true, true, true, true},
-			{false, false, false, false, true},
-			{false, false, false, true, false},
-			{false, false, true, false, false},
-			{false, true, false, false, false},
-		},
-		'8': {
-			{false, true, true, true, false},
-			{true, false, false, false, true},
-			{false, true, true, true, false},
-			{true, false, false, false, true},
-			{false, true, true, true, false},
-		},
-		'9': {
-			{false, true, true, true, false},
-			{true, false, false, false, true},
-			{false, true, true, true, true},
-			{false, false, false, false, true},
-			{false, true, true, true, false},
-		},
-	}
-	
-	for i, char := range scoreText {
-		if pattern, exists := letterPatterns[char]; exists {
-			letterStartX := startX + float32(i)*letterSpacing
-			
-			for row := 0; row < 5; row++ {
-				for col := 0; col < 5; col++ {
-					if pattern[row][col] {
-						x := letterStartX + float32(col)*pixelSize
-						y := startY + float32(row)*pixelSize
-						vector.DrawFilledRect(screen, x, y, pixelSize, pixelSize, color.RGBA{R: 255, G: 255, B: 255, A: 255}, false)
-					}
-				}
-			}
+	drawText(screen, scoreText, 10, 10, 2, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	switch {
+	case gs.demo:
+		drawText(screen, "DEMO", 10, 26, 2, PlayerColor)
+	case gs.assist != nil:
+		drawText(screen, "ASSIST", 10, 26, 2, PlayerColor)
+	}
+}
+
+// drawPlayerScores は同時プレイのときに、プレイヤーごとのスコアと残機をそれぞれの色で表示する。
+func (gs *GameScene) drawPlayerScores(screen *ebiten.Image) {
+	screenWidth, _ := ScreenSize()
+	columnWidth := float32(screenWidth) / float32(len(gs.players))
+	for i, player := range gs.players {
+		x := 10 + columnWidth*float32(i)
+		drawText(screen, fmt.Sprintf("%dUP %d", i+1, player.Score), x, 10, 2, player.Color)
+		for life := 0; life < player.Lives; life++ {
+			vector.DrawFilledCircle(screen, x+5+float32(life)*14, 32, 5, player.Color, true)
 		}
 	}
 }
 
-type GameOverScene struct{}
+type GameOverScene struct {
+	next func() Scene // Enter で移る先。nil の場合はこの画面のまま
+}
 
 func (gos *GameOverScene) Update() Scene {
+	if gos.next != nil && inpututil.IsKeyJustPressed(ebiten.KeyEnter) && !ebiten.IsKeyPressed(ebiten.KeyAlt) {
+		return gos.next()
+	}
 	return gos
 }
 
 func (gos *GameOverScene) Draw(screen *ebiten.Image) {
 	screen.Fill(color.RGBA{R: 0, G: 0, B: 0, A: 255})
 	
-	screenWidth := 16 * TileSize
-	screenHeight := 10 * TileSize
+	screenWidth, screenHeight := ScreenSize()
 	
 	centerX := float32(screenWidth / 2)
 	centerY := float32(screenHeight / 2)
@@ -612,19 +1234,26 @@ func (gos *GameOverScene) Draw(screen *ebiten.Image) {
 			}
 		}
 	}
+	if gos.next != nil {
+		drawTextCentered(screen, "PRESS ENTER", centerX, centerY+60, 2, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	}
 }
 
-type StageClearScene struct{}
+type StageClearScene struct {
+	next func() Scene // Enter で移る先。nil の場合はこの画面のまま
+}
 
 func (scs *StageClearScene) Update() Scene {
+	if scs.next != nil && inpututil.IsKeyJustPressed(ebiten.KeyEnter) && !ebiten.IsKeyPressed(ebiten.KeyAlt) {
+		return scs.next()
+	}
 	return scs
 }
 
 func (scs *StageClearScene) Draw(screen *ebiten.Image) {
 	screen.Fill(color.RGBA{R: 0, G: 0, B: 0, A: 255})
 	
-	screenWidth := 16 * TileSize
-	screenHeight := 10 * TileSize
+	screenWidth, screenHeight := ScreenSize()
 	
 	centerX := float32(screenWidth / 2)
 	centerY := float32(screenHeight / 2)
@@ -729,64 +1358,133 @@ func (scs *StageClearScene) Draw(screen *ebiten.Image) {
 			}
 		}
 	}
+	if scs.next != nil {
+		drawTextCentered(screen, "PRESS ENTER", centerX, centerY+60, 2, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	}
 }
 
 type Game struct {
 	currentScene Scene
+	canvas       *ebiten.Image
 }
 
 func (g *Game) Update() error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) || (inpututil.IsKeyJustPressed(ebiten.KeyEnter) && ebiten.IsKeyPressed(ebiten.KeyAlt)) {
+		ebiten.SetFullscreen(!ebiten.IsFullscreen())
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+		debugOverlay = !debugOverlay
+	}
 	g.currentScene = g.currentScene.Update()
 	return nil
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	g.currentScene.Draw(screen)
+	// シーンは論理解像度のキャンバスに描き、ウィンドウには整数倍で拡大して貼る
+	width, height := ScreenSize()
+	if g.canvas == nil || g.canvas.Bounds().Dx() != width || g.canvas.Bounds().Dy() != height {
+		if g.canvas != nil {
+			g.canvas.Deallocate()
+		}
+		g.canvas = ebiten.NewImage(width, height)
+	}
+	g.canvas.Clear()
+	g.currentScene.Draw(g.canvas)
+	if debugOverlay {
+		drawFrameRate(g.canvas)
+	}
+	presentScaled(screen, g.canvas)
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
-	return 16 * TileSize, 10 * TileSize
+	width, height := g.LayoutF(float64(outsideWidth), float64(outsideHeight))
+	return int(width), int(height)
+}
+
+// LayoutF はウィンドウの実ピクセル数をそのまま画面サイズにする。拡大と黒帯は Draw で行う
+func (g *Game) LayoutF(outsideWidth, outsideHeight float64) (float64, float64) {
+	scale := ebiten.Monitor().DeviceScaleFactor()
+	return math.Ceil(outsideWidth * scale), math.Ceil(outsideHeight * scale)
 }
 
 func main() {
-	gameScene := &GameScene{
-		maze: [][]int{
-			{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
-			{1, 2, 2, 2, 2, 2, 3, 2, 2, 3, 2, 2, 2, 2, 2, 1},
-			{1, 2, 1, 1, 2, 1, 1, 1, 1, 1, 1, 2, 1, 1, 2, 1},
-			{1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1},
-			{1, 2, 1, 2, 1, 1, 0, 0, 0, 0, 1, 1, 2, 1, 2, 1},
-			{1, 2, 2, 2, 2, 2, 0, 0, 0, 0, 2, 2, 2, 2, 2, 1},
-			{1, 2, 1, 2, 1, 1, 0, 0, 0, 0, 1, 1, 2, 1, 2, 1},
-			{1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1},
-			{1, 2, 1, 1, 2, 1, 1, 1, 1, 1, 1, 2, 1, 1, 2, 1},
-			{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
-		},
-		player: Player{
-			X:     TileSize + TileSize/2,
-			Y:     TileSize + TileSize/2,
-			Speed: 2.0,
-		},
-		ghost: Ghost{
-			X:               TileSize*8 + TileSize/2,
-			Y:               TileSize*5 + TileSize/2,
-			Speed:           1.5,
-			DirX:            1.0,
-			DirY:            0.0,
-			State:           Normal,
-			FrightenedTimer: 0,
-			InitialX:        TileSize*8 + TileSize/2,
-			InitialY:        TileSize*5 + TileSize/2,
-		},
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
+	rate := flag.Int("rate", DefaultSimulationRate, "simulation steps per second")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed for ghost AI")
+	volume := flag.Float64("volume", 0.5, "sound volume (0-1)")
+	mute := flag.Bool("mute", false, "start with sound muted")
+	mazePath := flag.String("maze", "", "maze file to play (default: built-in maze)")
+	random := flag.Bool("random", false, "skip the title and play a generated maze")
+	editPath := flag.String("edit", "", "open the maze editor on this file (created on save if missing)")
+	hostAddr := flag.String("host", "", "skip the title and wait for an online player on this address (e.g. :7777)")
+	joinAddr := flag.String("join", "", "skip the title and join an online game at this address (e.g. 127.0.0.1:7777)")
+	telemetryDir := flag.String("telemetry", "", "write a JSON Lines log of every game into this directory (see the heatmap command)")
+	watchAddr := flag.String("watch", "", "skip the title and watch the games streamed by the serve command at this address (e.g. 127.0.0.1:7778)")
+	flag.Parse()
+	
+	maze := DefaultMaze()
+	if *mazePath != "" {
+		var err error
+		maze, err = LoadMaze(*mazePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// 壊れた迷路でも遊べるようにはするが、クリアできない原因が分かるように表示する
+		if report := ValidateMaze(maze); report.HasErrors() {
+			for _, issue := range report.Issues {
+				if issue.Severity == SeverityError {
+					log.Printf("%s: %s", *mazePath, issue)
+				}
+			}
+		}
+	}
+	app := NewApp(maze, GameConfig{
+		SimulationRate: *rate,
+		Seed:           *seed,
+		Sound:          NewSoundManager(*volume, *mute),
+		TelemetryDir:   *telemetryDir,
+	})
+	app.MazePath = *mazePath
+	scene := app.Title()
+	switch {
+	case *editPath != "":
+		edited, err := LoadMaze(*editPath)
+		if errors.Is(err, os.ErrNotExist) {
+			edited = NewBlankMaze(MaxScreenTilesX, MaxScreenTilesY)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		scene = NewEditorScene(app, edited, *editPath)
+	case *random:
+		scene = app.NewRandomGame()
+	case *hostAddr != "":
+		menu := NewNetMenuScene(app)
+		menu.address = *hostAddr
+		menu.Host()
+		scene = menu
+	case *joinAddr != "":
+		menu := NewNetMenuScene(app)
+		menu.address = *joinAddr
+		menu.Join()
+		scene = menu
+	case *watchAddr != "":
+		scene = NewSpectatorScene(*watchAddr, app.Title)
 	}
 	
 	game := &Game{
-		currentScene: gameScene,
+		currentScene: scene,
 	}
 	
+	// 描画フレームごとに Update を呼び、シミュレーションの刻みは FixedStep で管理する
+	ebiten.SetTPS(ebiten.SyncWithFPS)
 	ebiten.SetWindowTitle("PackMan Game")
-	ebiten.SetWindowSize(16*TileSize, 10*TileSize)
+	width, height := ScreenSize()
+	ebiten.SetWindowSize(width, height)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 	if err := ebiten.RunGame(game); err != nil {
 		panic(err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 迷路ファイルの書式:
+//
+//	; で始まる行はコメント
+//	#  壁            .  ドット        o  パワークッキー
+//	=  巣の扉        T  トンネル      (空白) 通路
+//	^ v < >  一方通行 (矢印の方向にしか出られない)
+//	P  プレイヤーの初期位置   G  ゴーストの初期位置 (複数可)
+//
+// 行の長さが揃っていない場合は短い行の右側を通路として扱う。
+var tileChars = map[rune]int{
+	'#': TileWall,
+	'.': TileDot,
+	'o': TilePellet,
+	'=': TileDoor,
+	'T': TileTunnel,
+	'^': TileOneWayUp,
+	'v': TileOneWayDown,
+	'<': TileOneWayLeft,
+	'>': TileOneWayRight,
+	' ': TileEmpty,
+	'P': TileEmpty,
+	'G': TileEmpty,
+}
+
+// FormatMaze は迷路を迷路ファイルの書式で書き出す。
+func FormatMaze(w io.Writer, m *Maze) error {
+	chars := map[int]rune{}
+	for c, tile := range tileChars {
+		if c != 'P' && c != 'G' {
+			chars[tile] = c
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for y, row := range m.Tiles {
+		line := make([]rune, len(row))
+		for x, tile := range row {
+			line[x] = chars[tile]
+		}
+		for _, g := range m.GhostStarts {
+			if g.Y == y {
+				line[g.X] = 'G'
+			}
+		}
+		if m.PlayerStart.Y == y {
+			line[m.PlayerStart.X] = 'P'
+		}
+		if _, err := bw.WriteString(string(line) + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+type Maze struct {
+	Tiles       [][]int
+	PlayerStart Point
+	GhostStarts []Point
+}
+
+func (m *Maze) Width() int {
+	if len(m.Tiles) == 0 {
+		return 0
+	}
+	return len(m.Tiles[0])
+}
+
+func (m *Maze) Height() int {
+	return len(m.Tiles)
+}
+
+// CloneTiles はタイルのコピーを返す。ゲーム中にドットを食べても元の迷路は変わらない。
+func (m *Maze) CloneTiles() [][]int {
+	tiles := make([][]int, len(m.Tiles))
+	for y, row := range m.Tiles {
+		tiles[y] = append([]int(nil), row...)
+	}
+	return tiles
+}
+
+// Clone は初期位置も含めた迷路全体のコピーを返す。
+func (m *Maze) Clone() *Maze {
+	return &Maze{
+		Tiles:       m.CloneTiles(),
+		PlayerStart: m.PlayerStart,
+		GhostStarts: append([]Point(nil), m.GhostStarts...),
+	}
+}
+
+func LoadMaze(path string) (*Maze, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := ParseMaze(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func ParseMaze(r io.Reader) (*Maze, error) {
+	var lines []string
+	var lineNumbers []int // lines のそれぞれがファイルの何行目か。コメント行を飛ばすので行の添字とずれる
+	width := 0
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, ";") {
+			continue
+		}
+		lines = append(lines, line)
+		lineNumbers = append(lineNumbers, n)
+		if n := len([]rune(line)); n > width {
+			width = n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// 末尾の空行は無視する
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 || width == 0 {
+		return nil, fmt.Errorf("maze is empty")
+	}
+
+	m := &Maze{PlayerStart: Point{X: -1, Y: -1}}
+	for y, line := range lines {
+		row := make([]int, width)
+		for x, c := range []rune(line) {
+			tile, ok := tileChars[c]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown tile %q", lineNumbers[y], c)
+			}
+			row[x] = tile
+			switch c {
+			case 'P':
+				m.PlayerStart = Point{X: x, Y: y}
+			case 'G':
+				m.GhostStarts = append(m.GhostStarts, Point{X: x, Y: y})
+			}
+		}
+		m.Tiles = append(m.Tiles, row)
+	}
+
+	if m.PlayerStart.X < 0 {
+		return nil, fmt.Errorf("maze has no player start (P)")
+	}
+	return m, nil
+}
+
+// DefaultMaze は最初から用意されている 16x10 の迷路。mazes/default.txt と同じで、プレイヤーの出発点にはドットがない。
+func DefaultMaze() *Maze {
+	return &Maze{
+		Tiles: [][]int{
+			{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+			{1, 0, 2, 2, 2, 2, 3, 2, 2, 3, 2, 2, 2, 2, 2, 1},
+			{1, 2, 1, 1, 2, 1, 1, 1, 1, 1, 1, 2, 1, 1, 2, 1},
+			{1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1},
+			{1, 2, 1, 2, 1, 1, 0, 0, 0, 0, 1, 1, 2, 1, 2, 1},
+			{1, 2, 2, 2, 2, 2, 0, 0, 0, 0, 2, 2, 2, 2, 2, 1},
+			{1, 2, 1, 2, 1, 1, 0, 0, 0, 0, 1, 1, 2, 1, 2, 1},
+			{1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1},
+			{1, 2, 1, 1, 2, 1, 1, 1, 1, 1, 1, 2, 1, 1, 2, 1},
+			{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		},
+		PlayerStart: Point{X: 1, Y: 1},
+		GhostStarts: []Point{{X: 8, Y: 5}},
+	}
+}
+
+// TileCenter はタイルの中心のピクセル座標を返す。
+func TileCenter(p Point) (float64, float64) {
+	return float64(p.X*TileSize + TileSize/2), float64(p.Y*TileSize + TileSize/2)
+}
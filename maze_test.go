@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefaultMazeFileMatchesBuiltIn(t *testing.T) {
+	m, err := LoadMaze("mazes/default.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := DefaultMaze(); !reflect.DeepEqual(m, want) {
+		t.Errorf("mazes/default.txt = %+v, want the built-in maze %+v", m, want)
+	}
+}
+
+// コメント行を飛ばしても、エラーの行番号はファイルの行を指す。
+func TestParseMazeErrorLineCountsComments(t *testing.T) {
+	_, err := ParseMaze(strings.NewReader("; comment\n; another\n####\n#P?#\n####\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 4:") {
+		t.Errorf("err = %v, want an error on line 4", err)
+	}
+}
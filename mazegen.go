@@ -0,0 +1,411 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+)
+
+type MazeGenOptions struct {
+	Width   int // 奇数に切り上げる
+	Height  int // 奇数に切り上げる
+	Seed    int64
+	Tunnels bool
+	Ghosts  int // 巣に置くゴーストの数 (1〜5)
+}
+
+const (
+	MinGenWidth  = 19
+	MinGenHeight = 15
+
+	// 巣 (壁を含む) の大きさ
+	houseWidth  = 7
+	houseHeight = 5
+)
+
+// mazeGenerator は左右対称の迷路を作る。
+// 奇数座標のタイルを通路の節点とする格子上で全域木を掘り、行き止まりをなくしてから巣とトンネルを置く。
+// 左半分を変更するときは必ず mirror した位置も同時に変更する。
+type mazeGenerator struct {
+	width  int
+	height int
+	tiles  [][]int
+	rng    *rand.Rand
+	// 巣とその周囲の通路。格子の掘削や行き止まりの処理で触らない
+	reserved [][]bool
+	houseX   int // 巣の左上
+	houseY   int
+}
+
+// GenerateMaze はシードから左右対称・行き止まりなし・全域連結の迷路を作る。
+// 同じオプションからは常に同じ迷路ができる。
+func GenerateMaze(opts MazeGenOptions) (*Maze, error) {
+	if opts.Width < MinGenWidth || opts.Height < MinGenHeight {
+		return nil, fmt.Errorf("maze must be at least %dx%d", MinGenWidth, MinGenHeight)
+	}
+	if opts.Ghosts <= 0 {
+		opts.Ghosts = 4
+	}
+	if opts.Ghosts > houseWidth-2 {
+		opts.Ghosts = houseWidth - 2
+	}
+
+	g := &mazeGenerator{
+		width:  opts.Width | 1,
+		height: opts.Height | 1,
+		rng:    rand.New(rand.NewSource(opts.Seed)),
+	}
+	g.tiles = make([][]int, g.height)
+	g.reserved = make([][]bool, g.height)
+	for y := range g.tiles {
+		g.tiles[y] = make([]int, g.width)
+		g.reserved[y] = make([]bool, g.width)
+		for x := range g.tiles[y] {
+			g.tiles[y][x] = TileWall
+		}
+	}
+
+	g.reserveHouse()
+	g.carveSpanningTree()
+	g.placeHouse()
+	g.connectComponents()
+	g.removeDeadEnds()
+	if opts.Tunnels {
+		g.carveTunnel()
+	}
+
+	m := &Maze{
+		Tiles:       g.tiles,
+		PlayerStart: Point{X: g.width / 2, Y: g.houseY + houseHeight},
+	}
+	for i := 0; i < opts.Ghosts; i++ {
+		m.GhostStarts = append(m.GhostStarts, Point{X: g.houseX + 1 + i, Y: g.houseY + 2})
+	}
+	g.placeDots(m.PlayerStart)
+
+	// 念のため、全てのドットにプレイヤーが到達できることを確かめる
+	pf := NewPathfinder(m.Tiles, false)
+	field := pf.DistanceField(m.PlayerStart)
+	for y, row := range m.Tiles {
+		for x, tile := range row {
+			if (tile == TileDot || tile == TilePellet) && field[y*g.width+x] < 0 {
+				return nil, fmt.Errorf("generated maze has unreachable dot at (%d, %d)", x, y)
+			}
+		}
+	}
+	return m, nil
+}
+
+func (g *mazeGenerator) mirror(x int) int {
+	return g.width - 1 - x
+}
+
+func (g *mazeGenerator) set(x, y, tile int) {
+	g.tiles[y][x] = tile
+	g.tiles[y][g.mirror(x)] = tile
+}
+
+func (g *mazeGenerator) isOpen(x, y int) bool {
+	return x >= 0 && x < g.width && y >= 0 && y < g.height && g.tiles[y][x] != TileWall
+}
+
+// reserveHouse は中央に巣とそれを囲む1マスの通路の場所を確保する。
+func (g *mazeGenerator) reserveHouse() {
+	g.houseX = g.width/2 - houseWidth/2
+	g.houseY = g.height/2 - houseHeight/2
+	for y := g.houseY - 1; y <= g.houseY+houseHeight; y++ {
+		for x := g.houseX - 1; x <= g.houseX+houseWidth; x++ {
+			g.reserved[y][x] = true
+		}
+	}
+}
+
+func (g *mazeGenerator) isNode(x, y int) bool {
+	return x%2 == 1 && y%2 == 1 && x > 0 && y > 0 && x < g.width-1 && y < g.height-1 && !g.reserved[y][x]
+}
+
+// carveSpanningTree は左半分 (中央列を含む) の節点を深さ優先で結ぶ。右半分は鏡像になる。
+func (g *mazeGenerator) carveSpanningTree() {
+	center := g.width / 2
+	visited := map[Point]bool{}
+
+	var start Point
+	for y := 1; y < g.height-1 && start == (Point{}); y += 2 {
+		for x := 1; x <= center; x += 2 {
+			if g.isNode(x, y) {
+				start = Point{X: x, Y: y}
+				break
+			}
+		}
+	}
+
+	stack := []Point{start}
+	visited[start] = true
+	g.set(start.X, start.Y, TileEmpty)
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		var candidates []Point
+		for _, dir := range Directions {
+			next := Point{X: current.X + dir.X*2, Y: current.Y + dir.Y*2}
+			// 中央をまたいだ節点は鏡像側の節点なので、左半分だけを辿る
+			if next.X > center+1 || !g.isNode(next.X, next.Y) || visited[next] {
+				continue
+			}
+			candidates = append(candidates, next)
+		}
+		if len(candidates) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		next := candidates[g.rng.Intn(len(candidates))]
+		g.set((current.X+next.X)/2, (current.Y+next.Y)/2, TileEmpty)
+		g.set(next.X, next.Y, TileEmpty)
+		visited[next] = true
+		visited[Point{X: g.mirror(next.X), Y: next.Y}] = true
+		stack = append(stack, next)
+	}
+
+	// 左右の半分をつなぐ通路を数本開ける
+	for y := 1; y < g.height-1; y += 2 {
+		x := center
+		if x%2 == 1 {
+			x = center - 1 // 中央列が節点の場合はその隣の壁
+			if !g.isNode(center, y) {
+				continue
+			}
+		}
+		if !g.reserved[y][x] && g.rng.Intn(3) == 0 {
+			g.set(x, y, TileEmpty)
+		}
+	}
+}
+
+// placeHouse は巣 (壁・扉・内部) と、巣を囲む通路を置く。
+func (g *mazeGenerator) placeHouse() {
+	for y := g.houseY - 1; y <= g.houseY+houseHeight; y++ {
+		for x := g.houseX - 1; x <= g.houseX+houseWidth; x++ {
+			inside := x >= g.houseX && x < g.houseX+houseWidth && y >= g.houseY && y < g.houseY+houseHeight
+			if !inside {
+				g.tiles[y][x] = TileEmpty // 巣を囲む通路
+				continue
+			}
+			border := x == g.houseX || x == g.houseX+houseWidth-1 || y == g.houseY || y == g.houseY+houseHeight-1
+			if border {
+				g.tiles[y][x] = TileWall
+			} else {
+				g.tiles[y][x] = TileEmpty
+			}
+		}
+	}
+	g.tiles[g.houseY][g.width/2] = TileDoor
+}
+
+// connectComponents は通路の連結成分がひとつになるまで、成分どうしを最短の壁の掘削でつなぐ。
+func (g *mazeGenerator) connectComponents() {
+	for {
+		components := g.components()
+		if len(components) <= 1 {
+			return
+		}
+		// 最初の成分から壁を通って最も近い別の成分まで掘る
+		g.carvePathBetween(components[0])
+	}
+}
+
+func (g *mazeGenerator) components() []map[Point]bool {
+	seen := map[Point]bool{}
+	var result []map[Point]bool
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			p := Point{X: x, Y: y}
+			if !g.isOpen(x, y) || seen[p] {
+				continue
+			}
+			component := map[Point]bool{}
+			queue := []Point{p}
+			seen[p] = true
+			for len(queue) > 0 {
+				current := queue[0]
+				queue = queue[1:]
+				component[current] = true
+				for _, dir := range Directions {
+					next := current.Add(dir)
+					if g.isOpen(next.X, next.Y) && !seen[next] {
+						seen[next] = true
+						queue = append(queue, next)
+					}
+				}
+			}
+			result = append(result, component)
+		}
+	}
+	return result
+}
+
+func (g *mazeGenerator) carvePathBetween(from map[Point]bool) {
+	prev := map[Point]Point{}
+	var queue []Point
+	for p := range from {
+		prev[p] = p
+		queue = append(queue, p)
+	}
+	// マップの走査順で結果が変わらないよう、始点を並べ替える
+	sortPoints(queue)
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dir := range Directions {
+			next := current.Add(dir)
+			if next.X <= 0 || next.Y <= 0 || next.X >= g.width-1 || next.Y >= g.height-1 {
+				continue
+			}
+			if _, ok := prev[next]; ok {
+				continue
+			}
+			if g.reserved[next.Y][next.X] && g.tiles[next.Y][next.X] == TileWall {
+				continue // 巣の壁は掘らない
+			}
+			prev[next] = current
+			if g.isOpen(next.X, next.Y) && !from[next] {
+				for p := current; !from[p]; p = prev[p] {
+					g.set(p.X, p.Y, TileEmpty)
+				}
+				return
+			}
+			queue = append(queue, next)
+		}
+	}
+}
+
+func sortPoints(points []Point) {
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].Y != points[j].Y {
+			return points[i].Y < points[j].Y
+		}
+		return points[i].X < points[j].X
+	})
+}
+
+func (g *mazeGenerator) openNeighbors(x, y int) int {
+	count := 0
+	for _, dir := range Directions {
+		if g.isOpen(x+dir.X, y+dir.Y) {
+			count++
+		}
+	}
+	return count
+}
+
+// removeDeadEnds は行き止まりの先の壁を掘って別の通路とつなぐ。つなげない行き止まりは埋める。
+func (g *mazeGenerator) removeDeadEnds() {
+	// 掘ると埋めるを繰り返して終わらなくなることがないよう、回数に上限を設ける
+	for pass, changed := 0, true; changed && pass < g.width*g.height; pass++ {
+		changed = false
+		for y := 1; y < g.height-1; y++ {
+			for x := 1; x <= g.width/2; x++ {
+				if !g.isOpen(x, y) || g.reserved[y][x] || g.openNeighbors(x, y) != 1 {
+					continue
+				}
+				changed = true
+
+				var options []Point
+				for _, dir := range Directions {
+					wall := Point{X: x + dir.X, Y: y + dir.Y}
+					beyond := Point{X: x + dir.X*2, Y: y + dir.Y*2}
+					if g.isOpen(wall.X, wall.Y) || wall.X <= 0 || wall.Y <= 0 || wall.X >= g.width-1 || wall.Y >= g.height-1 {
+						continue
+					}
+					if g.reserved[wall.Y][wall.X] || !g.isOpen(beyond.X, beyond.Y) {
+						continue
+					}
+					options = append(options, wall)
+				}
+				if len(options) == 0 {
+					g.set(x, y, TileWall)
+					continue
+				}
+				wall := options[g.rng.Intn(len(options))]
+				g.set(wall.X, wall.Y, TileEmpty)
+			}
+		}
+	}
+}
+
+// carveTunnel は巣の高さの行の両端にトンネルを開け、一番近い通路までつなぐ。
+func (g *mazeGenerator) carveTunnel() {
+	y := g.houseY + houseHeight/2
+	if y%2 == 0 {
+		y++ // 節点のある行にそろえる
+	}
+	g.set(0, y, TileTunnel)
+	for x := 1; x < g.width/2 && !g.isOpen(x, y); x++ {
+		g.set(x, y, TileEmpty)
+	}
+}
+
+// placeDots は巣とその周り以外の通路にドットを置き、四隅に近い通路にパワークッキーを置く。
+func (g *mazeGenerator) placeDots(playerStart Point) {
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			if g.tiles[y][x] == TileEmpty && !g.reserved[y][x] {
+				g.tiles[y][x] = TileDot
+			}
+		}
+	}
+	g.tiles[playerStart.Y][playerStart.X] = TileEmpty
+
+	for _, corner := range []Point{{X: 1, Y: 1}, {X: 1, Y: g.height - 2}} {
+		best := Point{X: -1}
+		bestDistance := 0
+		for y := 0; y < g.height; y++ {
+			for x := 0; x <= g.width/2; x++ {
+				if g.tiles[y][x] != TileDot {
+					continue
+				}
+				distance := abs(float64(x-corner.X)) + abs(float64(y-corner.Y))
+				if best.X < 0 || int(distance) < bestDistance {
+					best = Point{X: x, Y: y}
+					bestDistance = int(distance)
+				}
+			}
+		}
+		if best.X >= 0 {
+			g.set(best.X, best.Y, TilePellet)
+		}
+	}
+}
+
+// runGenMaze は genmaze コマンド。生成した迷路を迷路ファイルの書式で書き出す。
+func runGenMaze(args []string) error {
+	fs := flag.NewFlagSet("genmaze", flag.ExitOnError)
+	width := fs.Int("width", 27, "maze width in tiles (rounded up to odd)")
+	height := fs.Int("height", 31, "maze height in tiles (rounded up to odd)")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed")
+	tunnels := fs.Bool("tunnels", true, "carve wrap-around tunnels")
+	ghosts := fs.Int("ghosts", 4, "number of ghost spawns in the house")
+	out := fs.String("o", "", "output file (default: stdout)")
+	fs.Parse(args)
+
+	m, err := GenerateMaze(MazeGenOptions{Width: *width, Height: *height, Seed: *seed, Tunnels: *tunnels, Ghosts: *ghosts})
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	fmt.Fprintf(w, "; generated by genmaze -width %d -height %d -seed %d -tunnels=%t -ghosts %d\n", *width, *height, *seed, *tunnels, *ghosts)
+	return FormatMaze(w, m)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	dotRadius    = 2
+	pelletRadius = 5
+	// DrawTriangles のインデックスは uint16 なので、1回に描く頂点数をこれ以下に抑える
+	maxBatchVertices = math.MaxUint16 - 64
+)
+
+var (
+	whiteImage    *ebiten.Image
+	whiteSubImage *ebiten.Image
+)
+
+func solidSubImage() *ebiten.Image {
+	if whiteSubImage == nil {
+		whiteImage = ebiten.NewImage(3, 3)
+		whiteImage.Fill(color.White)
+		whiteSubImage = whiteImage.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
+	}
+	return whiteSubImage
+}
+
+type triangleBatch struct {
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+// ドットの頂点リストはこの大きさ (タイル数) の区画ごとに分けて持つ。
+// 画面外の区画は描かず、ドットが食べられたときもその区画だけ作り直す
+const dotChunkSize = 16
+
+type dotChunk struct {
+	triangleBatch
+	dirty bool
+}
+
+// MazeRenderer は迷路の描画をキャッシュする。
+// 壁はオフスクリーン画像に一度だけ描いておき、ドットは区画ごとの頂点リストをまとめて DrawTriangles で描く。
+type MazeRenderer struct {
+	WallColor  color.RGBA
+	wallLayer  *ebiten.Image
+	wallsDirty bool
+	dotChunks  [][]dotChunk // [区画の行][区画の列]
+	dotsDirty  bool
+	scratch    triangleBatch
+}
+
+func NewMazeRenderer(wallColor color.RGBA) *MazeRenderer {
+	return &MazeRenderer{WallColor: wallColor, wallsDirty: true, dotsDirty: true}
+}
+
+// SetWallColor は壁の色を変更する (レベルが変わったときなど)。
+func (r *MazeRenderer) SetWallColor(clr color.RGBA) {
+	if r.WallColor != clr {
+		r.WallColor = clr
+		r.wallsDirty = true
+	}
+}
+
+// InvalidateWalls は壁の配置が変わったときに呼ぶ。次の Draw で壁レイヤーを作り直す。
+func (r *MazeRenderer) InvalidateWalls() {
+	r.wallsDirty = true
+}
+
+// InvalidateDots はドットやパワークッキーの配置がまとめて変わったときに呼ぶ。
+func (r *MazeRenderer) InvalidateDots() {
+	r.dotsDirty = true
+}
+
+// InvalidateDotAt はタイル (x, y) のドットが増減したときに呼ぶ。その区画だけ作り直す。
+func (r *MazeRenderer) InvalidateDotAt(x, y int) {
+	cy, cx := y/dotChunkSize, x/dotChunkSize
+	if r.dotsDirty || cy >= len(r.dotChunks) || cx >= len(r.dotChunks[cy]) {
+		r.dotsDirty = true
+		return
+	}
+	r.dotChunks[cy][cx].dirty = true
+}
+
+// Draw は (cameraX, cameraY) を画面左上とする範囲の迷路を描く。画面外の部分は描かない。
+func (r *MazeRenderer) Draw(screen *ebiten.Image, maze [][]int, cameraX, cameraY float64) {
+	if r.wallsDirty {
+		r.buildWallLayer(maze)
+	}
+	if r.dotsDirty {
+		r.resetDotChunks(maze)
+	}
+
+	view := image.Rect(int(cameraX), int(cameraY), int(cameraX)+screen.Bounds().Dx()+1, int(cameraY)+screen.Bounds().Dy()+1)
+	visible := view.Intersect(r.wallLayer.Bounds())
+	if !visible.Empty() {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(visible.Min.X)-cameraX, float64(visible.Min.Y)-cameraY)
+		screen.DrawImage(r.wallLayer.SubImage(visible).(*ebiten.Image), op)
+	}
+
+	chunkPixels := dotChunkSize * TileSize
+	op := &ebiten.DrawTrianglesOptions{}
+	for cy := max(0, view.Min.Y/chunkPixels); cy < len(r.dotChunks) && cy*chunkPixels < view.Max.Y; cy++ {
+		for cx := max(0, view.Min.X/chunkPixels); cx < len(r.dotChunks[cy]) && cx*chunkPixels < view.Max.X; cx++ {
+			chunk := &r.dotChunks[cy][cx]
+			if chunk.dirty {
+				r.buildDotChunk(maze, cx, cy)
+			}
+			if len(chunk.indices) == 0 {
+				continue
+			}
+			// 頂点はワールド座標で持っているので、カメラ位置だけずらしたコピーを描く
+			r.scratch.vertices = append(r.scratch.vertices[:0], chunk.vertices...)
+			for i := range r.scratch.vertices {
+				r.scratch.vertices[i].DstX -= float32(cameraX)
+				r.scratch.vertices[i].DstY -= float32(cameraY)
+			}
+			screen.DrawTriangles(r.scratch.vertices, chunk.indices, solidSubImage(), op)
+		}
+	}
+}
+
+func (r *MazeRenderer) buildWallLayer(maze [][]int) {
+	width := len(maze[0]) * TileSize
+	height := len(maze) * TileSize
+	if r.wallLayer == nil || r.wallLayer.Bounds().Dx() != width || r.wallLayer.Bounds().Dy() != height {
+		if r.wallLayer != nil {
+			r.wallLayer.Deallocate()
+		}
+		r.wallLayer = ebiten.NewImage(width, height)
+	}
+	r.wallLayer.Clear()
+	drawWalls(r.wallLayer, maze, r.WallColor)
+	r.wallsDirty = false
+}
+
+func (r *MazeRenderer) resetDotChunks(maze [][]int) {
+	rows := (len(maze) + dotChunkSize - 1) / dotChunkSize
+	cols := (len(maze[0]) + dotChunkSize - 1) / dotChunkSize
+	r.dotChunks = make([][]dotChunk, rows)
+	for cy := range r.dotChunks {
+		r.dotChunks[cy] = make([]dotChunk, cols)
+		for cx := range r.dotChunks[cy] {
+			r.dotChunks[cy][cx].dirty = true
+		}
+	}
+	r.dotsDirty = false
+}
+
+func (r *MazeRenderer) buildDotChunk(maze [][]int, cx, cy int) {
+	chunk := &r.dotChunks[cy][cx]
+	chunk.vertices = chunk.vertices[:0]
+	chunk.indices = chunk.indices[:0]
+
+	for y := cy * dotChunkSize; y < min(len(maze), (cy+1)*dotChunkSize); y++ {
+		for x := cx * dotChunkSize; x < min(len(maze[y]), (cx+1)*dotChunkSize); x++ {
+			var radius float32
+			switch maze[y][x] {
+			case TileDot:
+				radius = dotRadius
+			case TilePellet:
+				radius = pelletRadius
+			default:
+				continue
+			}
+
+			var path vector.Path
+			centerX := float32(x*TileSize + TileSize/2)
+			centerY := float32(y*TileSize + TileSize/2)
+			path.Arc(centerX, centerY, radius, 0, 2*math.Pi, vector.Clockwise)
+			path.Close()
+			chunk.vertices, chunk.indices = path.AppendVerticesAndIndicesForFilling(chunk.vertices, chunk.indices)
+		}
+	}
+
+	for i := range chunk.vertices {
+		chunk.vertices[i].SrcX = 1
+		chunk.vertices[i].SrcY = 1
+	}
+	chunk.dirty = false
+}
+
+// countDots は迷路に残っているドットとパワークッキーの数を返す。
+func countDots(maze [][]int) int {
+	count := 0
+	for _, row := range maze {
+		for _, tile := range row {
+			if tile == TileDot || tile == TilePellet {
+				count++
+			}
+		}
+	}
+	return count
+}
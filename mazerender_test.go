@@ -0,0 +1,131 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// 描画のベンチマークに使う迷路の大きさ (タイル数)。画面に収まらずカメラでスクロールする大きさにする
+const (
+	benchMazeWidth  = 99
+	benchMazeHeight = 99
+)
+
+func largeTestMaze(b *testing.B) [][]int {
+	b.Helper()
+	m, err := GenerateMaze(MazeGenOptions{Width: benchMazeWidth, Height: benchMazeHeight, Seed: 1, Tunnels: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return m.CloneTiles()
+}
+
+// benchScreen は論理解像度の上限の大きさの画面を返す。迷路は (benchCameraX, benchCameraY) から描く。
+func benchScreen() *ebiten.Image {
+	return ebiten.NewImage(MaxScreenTilesX*TileSize, MaxScreenTilesY*TileSize)
+}
+
+const (
+	benchCameraX = 30 * TileSize
+	benchCameraY = 30 * TileSize
+)
+
+// drawMazePerTile はキャッシュする前の描き方。見える範囲のタイルを1つずつ DrawFilledRect と DrawFilledCircle で描く。
+func drawMazePerTile(screen *ebiten.Image, maze [][]int, cameraX, cameraY float64) {
+	wall := WallColorForLevel(1)
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	w, h := screen.Bounds().Dx(), screen.Bounds().Dy()
+	for y := int(cameraY) / TileSize; y < len(maze) && y*TileSize < int(cameraY)+h; y++ {
+		for x := int(cameraX) / TileSize; x < len(maze[y]) && x*TileSize < int(cameraX)+w; x++ {
+			left := float32(float64(x*TileSize) - cameraX)
+			top := float32(float64(y*TileSize) - cameraY)
+			switch maze[y][x] {
+			case TileWall:
+				vector.DrawFilledRect(screen, left, top, TileSize, TileSize, wall, false)
+			case TileDot:
+				vector.DrawFilledCircle(screen, left+TileSize/2, top+TileSize/2, dotRadius, white, false)
+			case TilePellet:
+				vector.DrawFilledCircle(screen, left+TileSize/2, top+TileSize/2, pelletRadius, white, false)
+			}
+		}
+	}
+}
+
+func BenchmarkMazeDrawCached(b *testing.B) {
+	maze := largeTestMaze(b)
+	screen := benchScreen()
+	r := NewMazeRenderer(WallColorForLevel(1))
+	// 壁のレイヤーとドットの頂点は最初の Draw で作る
+	r.Draw(screen, maze, benchCameraX, benchCameraY)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Draw(screen, maze, benchCameraX, benchCameraY)
+	}
+}
+
+// BenchmarkMazeDrawCachedDotEaten は毎フレームどこかのドットが食べられる場合。食べた区画だけ頂点を作り直す。
+func BenchmarkMazeDrawCachedDotEaten(b *testing.B) {
+	maze := largeTestMaze(b)
+	screen := benchScreen()
+	r := NewMazeRenderer(WallColorForLevel(1))
+	r.Draw(screen, maze, benchCameraX, benchCameraY)
+	x, y := firstDotInView(b, maze)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// 同じドットを食べたり戻したりする
+		if maze[y][x] == TileDot {
+			maze[y][x] = TileEmpty
+		} else {
+			maze[y][x] = TileDot
+		}
+		r.InvalidateDotAt(x, y)
+		r.Draw(screen, maze, benchCameraX, benchCameraY)
+	}
+}
+
+func firstDotInView(b *testing.B, maze [][]int) (int, int) {
+	for y := benchCameraY / TileSize; y < len(maze); y++ {
+		for x := benchCameraX / TileSize; x < len(maze[y]); x++ {
+			if maze[y][x] == TileDot {
+				return x, y
+			}
+		}
+	}
+	b.Fatal("no dot in view")
+	return 0, 0
+}
+
+func BenchmarkMazeDrawPerTile(b *testing.B) {
+	maze := largeTestMaze(b)
+	screen := benchScreen()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		drawMazePerTile(screen, maze, benchCameraX, benchCameraY)
+	}
+}
+
+// BenchmarkDotsRemainingIncremental は面クリアの判定を、食べるたびに減らす残りの数で行う場合。
+func BenchmarkDotsRemainingIncremental(b *testing.B) {
+	maze := largeTestMaze(b)
+	gs := &GameScene{maze: maze, dotsRemaining: countDots(maze)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if gs.checkStageClear() {
+			b.Fatal("maze has no dots")
+		}
+	}
+}
+
+// BenchmarkDotsRemainingScan は面クリアの判定のたびに迷路全体を走査する場合。
+func BenchmarkDotsRemainingScan(b *testing.B) {
+	maze := largeTestMaze(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if countDots(maze) == 0 {
+			b.Fatal("maze has no dots")
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	minimapMargin   = 6
+	maxMinimapScale = 3 // 1タイルあたりの最大ピクセル数
+)
+
+var (
+	minimapBackground = color.RGBA{R: 0, G: 0, B: 0, A: 180}
+	minimapWallColor  = color.RGBA{R: 33, G: 33, B: 255, A: 255}
+	minimapDotColor   = color.RGBA{R: 200, G: 200, B: 200, A: 255}
+	minimapViewColor  = color.RGBA{R: 255, G: 255, B: 255, A: 160}
+)
+
+// Minimap は迷路全体を縮小して画面の右上に表示する。
+// 壁とドットはピクセルバッファに持ち、変化があったタイルだけ書き換える。
+type Minimap struct {
+	scale  int
+	width  int
+	height int
+	pixels []byte
+	image  *ebiten.Image
+	dirty  bool
+}
+
+func NewMinimap(maze [][]int, screenW, screenH int) *Minimap {
+	width, height := len(maze[0]), len(maze)
+	// 画面の 1/3 に収まる大きさにする
+	scale := min(maxMinimapScale, screenW/3/width, screenH/3/height)
+	if scale < 1 {
+		scale = 1
+	}
+	m := &Minimap{
+		scale:  scale,
+		width:  width,
+		height: height,
+		pixels: make([]byte, width*scale*height*scale*4),
+	}
+	for y, row := range maze {
+		for x, tile := range row {
+			m.SetTile(x, y, tile)
+		}
+	}
+	return m
+}
+
+// SetTile はタイル (x, y) の表示を更新する。
+func (m *Minimap) SetTile(x, y, tile int) {
+	clr := color.RGBA{}
+	switch tile {
+	case TileWall:
+		clr = minimapWallColor
+	case TileDoor:
+		clr = DoorColor
+	}
+
+	stride := m.width * m.scale * 4
+	for dy := 0; dy < m.scale; dy++ {
+		for dx := 0; dx < m.scale; dx++ {
+			c := clr
+			// ドットは区画の中央の1ピクセルだけ
+			if (tile == TileDot || tile == TilePellet) && dx == m.scale/2 && dy == m.scale/2 {
+				c = minimapDotColor
+			}
+			i := (y*m.scale+dy)*stride + (x*m.scale+dx)*4
+			m.pixels[i], m.pixels[i+1], m.pixels[i+2], m.pixels[i+3] = c.R, c.G, c.B, c.A
+		}
+	}
+	m.dirty = true
+}
+
+// Draw はミニマップと、カメラが映している範囲の枠を描く。
+func (m *Minimap) Draw(screen *ebiten.Image, players []*Player, ghosts []*Ghost, cameraX, cameraY float64) {
+	w, h := m.width*m.scale, m.height*m.scale
+	if m.image == nil {
+		m.image = ebiten.NewImage(w, h)
+	}
+	if m.dirty {
+		m.image.WritePixels(m.pixels)
+		m.dirty = false
+	}
+
+	screenW := screen.Bounds().Dx()
+	screenH := screen.Bounds().Dy()
+	left := float32(screenW - w - minimapMargin)
+	top := float32(minimapMargin)
+	vector.DrawFilledRect(screen, left-2, top-2, float32(w+4), float32(h+4), minimapBackground, false)
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(float64(left), float64(top))
+	screen.DrawImage(m.image, op)
+
+	scale := float32(m.scale) / TileSize
+	for _, ghost := range ghosts {
+		if ghost.State == Eaten {
+			continue
+		}
+		vector.DrawFilledRect(screen, left+float32(ghost.X)*scale-1, top+float32(ghost.Y)*scale-1, 3, 3, ghost.Color, false)
+	}
+	for _, player := range players {
+		if player.Alive() {
+			vector.DrawFilledRect(screen, left+float32(player.X)*scale-1, top+float32(player.Y)*scale-1, 3, 3, player.Color, false)
+		}
+	}
+
+	vector.StrokeRect(screen, left+float32(cameraX)*scale, top+float32(cameraY)*scale, float32(screenW)*scale, float32(screenH)*scale, 1, minimapViewColor, false)
+}
@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	netProtocolVersion = 1
+	DefaultInputDelay  = 2  // 押した入力を何フレーム後に反映するか。この分だけ相手に届くまでの猶予になる
+	DefaultMaxRollback = 8  // 相手の入力を予測して先に進めてよいフレーム数。これを超えると相手を待つ
+	checksumInterval   = 60 // 何フレームごとに状態のチェックサムを送って比べるか
+)
+
+var errPeerLeft = errors.New("the other player left")
+
+// DesyncError は2つのゲームの状態が食い違ったことを表す。
+type DesyncError struct {
+	Frame       int
+	Local, Peer uint64
+}
+
+func (e *DesyncError) Error() string {
+	return fmt.Sprintf("desync at frame %d: checksum %016x, peer %016x", e.Frame, e.Local, e.Peer)
+}
+
+// netMessage は TCP で送り合うメッセージ。1行に1つの JSON で送る。
+//
+//	hello  接続直後。ホストはゲームの設定 (シード・迷路・入力遅延) を送り、参加者は同じ type で応える
+//	input  frame 番目のフレームの入力
+//	sum    frame 番目のフレームを始める前の状態のチェックサム
+//	bye    相手が抜けた
+type netMessage struct {
+	Type    string `json:"type"`
+	Version int    `json:"version,omitempty"`
+	Seed    int64  `json:"seed,omitempty"`
+	Maze    string `json:"maze,omitempty"`
+	Delay   int    `json:"delay,omitempty"`
+	Rate    int    `json:"rate,omitempty"`
+	Frame   int    `json:"frame,omitempty"`
+	Input   uint8  `json:"input,omitempty"`
+	Sum     uint64 `json:"sum,omitempty"`
+	Error   string `json:"-"` // 受信側で通信エラーを知らせるのに使う
+}
+
+func encodeInput(in PlayerInput) uint8 {
+	var bits uint8
+	for i, pressed := range []bool{in.Up, in.Down, in.Left, in.Right} {
+		if pressed {
+			bits |= 1 << i
+		}
+	}
+	return bits
+}
+
+func decodeInput(bits uint8) PlayerInput {
+	return PlayerInput{Up: bits&1 != 0, Down: bits&2 != 0, Left: bits&4 != 0, Right: bits&8 != 0}
+}
+
+// NetConfig は通信対戦の調整値。
+type NetConfig struct {
+	Delay       int           // 入力遅延 (フレーム)。ホストの値を使う。0 なら DefaultInputDelay
+	MaxRollback int           // 0 なら DefaultMaxRollback
+	Latency     time.Duration // 送信を人工的に遅らせる。ループバックで遅延を試すのに使う
+}
+
+// NetSession は2台のゲームを入力だけのやりとりで同じように進める。
+//
+// シミュレーションは決定的なので、同じ初期状態から同じ入力を与えれば同じ結果になる。
+// 自分の入力は Delay フレーム後のフレームのものとして相手に送る。相手の入力がまだ届いていない
+// フレームは直前の入力が続くと予測して先に進め、実際の入力が予測と違っていたら、そのフレームの
+// スナップショットまで巻き戻して進め直す (ロールバック)。予測で進めるのは MaxRollback フレームまでで、
+// それ以上相手が遅れたら待つ。確定した状態のチェックサムを定期的に送り合い、食い違ったら同期ずれとして止める。
+type NetSession struct {
+	gs     *GameScene
+	maze   *Maze
+	config GameConfig
+	local  int // 自分が操作するプレイヤー。ホストが 0、参加者が 1
+	dt     float64
+
+	conn     net.Conn
+	dec      *json.Decoder
+	started  bool
+	source   Controller // 自分の入力を決める (キーボードやボット)
+	incoming chan netMessage
+	outgoing chan timedMessage
+	done     chan struct{}
+	flushed  chan struct{} // bye を送り終えたら閉じる
+	latency  time.Duration
+
+	delay       int
+	maxRollback int
+	frame       int                    // 次に進めるフレーム
+	confirmed   int                    // 相手の入力がこのフレームの手前まですべて届いている
+	inputs      [2]map[int]PlayerInput // 確定した入力
+	predicted   map[int]PlayerInput    // 相手の入力を予測して進めたフレームと、その予測
+	current     [2]PlayerInput         // 今進めているフレームの入力
+	snapshots   map[int]*GameSnapshot  // 各フレームを始める前の状態
+	sums        [2]map[int]uint64      // チェックサム。[0] が自分、[1] が相手
+	nextSum     int                    // 次にチェックサムを送るフレーム
+	ended       int                    // 決着がついたフレーム。-1 ならまだ。相手の入力で確定するまでは覆りうる
+	result      Scene
+
+	finished  bool
+	peerLeft  bool // 相手が bye を送った。届いた入力を使い切るまでは進められる
+	err       error
+	Rollbacks int // 巻き戻した回数
+	Stalls    int // 相手を待って進めなかった回数
+}
+
+type timedMessage struct {
+	msg  netMessage
+	sent time.Time
+}
+
+// netController は NetSession が決めたそのフレームの入力をプレイヤーに渡す。
+type netController struct {
+	session *NetSession
+	slot    int
+}
+
+func (c netController) Input(gs *GameScene, p *Player, dt float64) PlayerInput {
+	return c.session.current[c.slot]
+}
+
+// HostSession はホストとして conn の相手にゲームの設定を送る。Start を呼ぶとゲームが始まる。
+// ホストは1人目のプレイヤーを source で操作する。
+func HostSession(conn net.Conn, maze *Maze, config GameConfig, netConfig NetConfig, source Controller) (*NetSession, error) {
+	if netConfig.Delay <= 0 {
+		netConfig.Delay = DefaultInputDelay
+	}
+	if config.SimulationRate <= 0 {
+		config.SimulationRate = DefaultSimulationRate
+	}
+	var text bytes.Buffer
+	if err := FormatMaze(&text, maze); err != nil {
+		return nil, err
+	}
+	// 迷路ファイルの書式に P の下のドットなどは残らないので、ホストも参加者に送るのと同じものを使う
+	maze, err := ParseMaze(bytes.NewReader(text.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	hello := netMessage{
+		Type:    "hello",
+		Version: netProtocolVersion,
+		Seed:    config.Seed,
+		Maze:    text.String(),
+		Delay:   netConfig.Delay,
+		Rate:    config.SimulationRate,
+	}
+	if err := enc.Encode(hello); err != nil {
+		return nil, err
+	}
+	if err := readHello(dec); err != nil {
+		return nil, err
+	}
+	return newNetSession(conn, dec, 0, maze, config, netConfig, source), nil
+}
+
+// JoinSession は参加者として conn のホストから設定を受け取る。Start を呼ぶとゲームが始まる。
+// 参加者は2人目のプレイヤーを source で操作する。迷路やシードはホストのものを使う。
+func JoinSession(conn net.Conn, config GameConfig, netConfig NetConfig, source Controller) (*NetSession, error) {
+	dec := json.NewDecoder(conn)
+	var hello netMessage
+	if err := dec.Decode(&hello); err != nil {
+		return nil, err
+	}
+	if hello.Type != "hello" || hello.Version != netProtocolVersion {
+		return nil, fmt.Errorf("unsupported host (protocol %d, want %d)", hello.Version, netProtocolVersion)
+	}
+	maze, err := ParseMaze(bytes.NewReader([]byte(hello.Maze)))
+	if err != nil {
+		return nil, fmt.Errorf("maze from host: %w", err)
+	}
+	if err := json.NewEncoder(conn).Encode(netMessage{Type: "hello", Version: netProtocolVersion}); err != nil {
+		return nil, err
+	}
+	config.Seed = hello.Seed
+	config.SimulationRate = hello.Rate
+	netConfig.Delay = hello.Delay
+	return newNetSession(conn, dec, 1, maze, config, netConfig, source), nil
+}
+
+func readHello(dec *json.Decoder) error {
+	var hello netMessage
+	if err := dec.Decode(&hello); err != nil {
+		return err
+	}
+	if hello.Type != "hello" || hello.Version != netProtocolVersion {
+		return fmt.Errorf("unsupported peer (protocol %d, want %d)", hello.Version, netProtocolVersion)
+	}
+	return nil
+}
+
+func newNetSession(conn net.Conn, dec *json.Decoder, local int, maze *Maze, config GameConfig, netConfig NetConfig, source Controller) *NetSession {
+	if netConfig.MaxRollback <= 0 {
+		netConfig.MaxRollback = DefaultMaxRollback
+	}
+	config.Players = 2
+	config.Lives = StartingLives
+	// 巻き戻しで同じステップを何度もやり直すので、記録は取らない
+	config.TelemetryDir = ""
+	return &NetSession{
+		maze:        maze,
+		config:      config,
+		local:       local,
+		conn:        conn,
+		dec:         dec,
+		source:      source,
+		incoming:    make(chan netMessage, 256),
+		outgoing:    make(chan timedMessage, 256),
+		done:        make(chan struct{}),
+		flushed:     make(chan struct{}),
+		latency:     netConfig.Latency,
+		delay:       netConfig.Delay,
+		maxRollback: netConfig.MaxRollback,
+		inputs:      [2]map[int]PlayerInput{{}, {}},
+		predicted:   map[int]PlayerInput{},
+		snapshots:   map[int]*GameSnapshot{},
+		sums:        [2]map[int]uint64{{}, {}},
+		ended:       -1,
+	}
+}
+
+// Start は画面サイズを迷路に合わせてゲームを作り、入力のやりとりを始める。
+func (s *NetSession) Start() {
+	SetScreenSizeForMaze(s.maze)
+	config := s.config
+	config.Controllers = []Controller{netController{s, 0}, netController{s, 1}}
+	s.gs = NewGameScene(s.maze, config)
+	s.dt = s.gs.clock.Dt()
+
+	// 最初の Delay フレームはどちらも何も押していないことにする
+	for f := 0; f < s.delay; f++ {
+		s.inputs[0][f] = PlayerInput{}
+		s.inputs[1][f] = PlayerInput{}
+	}
+	s.confirmed = s.delay
+
+	s.started = true
+	go s.readLoop(s.dec)
+	go s.writeLoop(json.NewEncoder(s.conn))
+}
+
+func (s *NetSession) readLoop(dec *json.Decoder) {
+	for {
+		var msg netMessage
+		if err := dec.Decode(&msg); err != nil {
+			msg = netMessage{Type: "error", Error: err.Error()}
+		}
+		select {
+		case s.incoming <- msg:
+		case <-s.done:
+			return
+		}
+		if msg.Type == "error" {
+			return
+		}
+	}
+}
+
+func (s *NetSession) writeLoop(enc *json.Encoder) {
+	for {
+		select {
+		case m := <-s.outgoing:
+			if wait := time.Until(m.sent.Add(s.latency)); wait > 0 {
+				time.Sleep(wait)
+			}
+			if err := enc.Encode(m.msg); err != nil {
+				select {
+				case s.incoming <- netMessage{Type: "error", Error: err.Error()}:
+				case <-s.done:
+				}
+				return
+			}
+			if m.msg.Type == "bye" {
+				close(s.flushed)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *NetSession) send(msg netMessage) {
+	select {
+	case s.outgoing <- timedMessage{msg: msg, sent: time.Now()}:
+	case <-s.done:
+	}
+}
+
+// Game は同期しているゲームを返す。描画に使う。
+func (s *NetSession) Game() *GameScene {
+	return s.gs
+}
+
+// Frame は次に進めるフレームを返す。
+func (s *NetSession) Frame() int {
+	return s.frame
+}
+
+// Confirmed は相手の入力がそろっているフレーム数を返す。
+func (s *NetSession) Confirmed() int {
+	return s.confirmed
+}
+
+// Err は通信エラーや同期ずれで止まったときにその理由を返す。
+func (s *NetSession) Err() error {
+	return s.err
+}
+
+// Result は決着が確定していれば、そのときのシーン (GameOverScene か StageClearScene) を返す。
+func (s *NetSession) Result() (Scene, bool) {
+	return s.result, s.finished
+}
+
+// Waiting は相手の入力を待って止まっているかどうかを返す。
+func (s *NetSession) Waiting() bool {
+	return s.err == nil && (s.ended >= 0 || s.frame-s.confirmed >= s.maxRollback)
+}
+
+// Close は相手に抜けることを知らせて接続を閉じる。
+func (s *NetSession) Close() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	if s.started && s.err == nil {
+		// 送りかけの入力のあとに bye を送り、少しだけ送り終わるのを待つ
+		s.send(netMessage{Type: "bye"})
+		select {
+		case <-s.flushed:
+		case <-time.After(time.Second):
+		}
+	}
+	close(s.done)
+	s.conn.Close()
+}
+
+// Tick は届いたメッセージを処理し、進められれば1フレーム進める。進めたら true を返す。
+func (s *NetSession) Tick() bool {
+	s.Poll()
+	if s.err != nil || s.finished || s.Waiting() {
+		if s.err == nil && !s.finished {
+			s.Stalls++
+			if s.peerLeft {
+				s.err = errPeerLeft
+			}
+		}
+		return false
+	}
+	in := s.source.Input(s.gs, s.gs.players[s.local], s.dt)
+	target := s.frame + s.delay
+	s.inputs[s.local][target] = in
+	s.send(netMessage{Type: "input", Frame: target, Input: encodeInput(in)})
+	s.step()
+	s.checkpoint()
+	return true
+}
+
+// Poll は届いたメッセージを処理する。予測が外れていたら巻き戻して進め直す。
+func (s *NetSession) Poll() {
+	rollback := -1
+	remote := 1 - s.local
+	defer func() { s.finishPoll(rollback) }()
+	for s.err == nil {
+		var msg netMessage
+		select {
+		case msg = <-s.incoming:
+		default:
+			return
+		}
+		switch msg.Type {
+		case "input":
+			in := decodeInput(msg.Input)
+			s.inputs[remote][msg.Frame] = in
+			if guess, ok := s.predicted[msg.Frame]; ok {
+				delete(s.predicted, msg.Frame)
+				if guess != in && (rollback < 0 || msg.Frame < rollback) {
+					rollback = msg.Frame
+				}
+			}
+			for {
+				if _, ok := s.inputs[remote][s.confirmed]; !ok {
+					break
+				}
+				s.confirmed++
+			}
+		case "sum":
+			s.sums[1][msg.Frame] = msg.Sum
+			s.compareSums(msg.Frame)
+		case "bye":
+			s.peerLeft = true
+		case "error":
+			if !s.peerLeft {
+				s.err = errors.New(msg.Error)
+			}
+		}
+	}
+}
+
+func (s *NetSession) finishPoll(rollback int) {
+	if s.err != nil {
+		return
+	}
+	if rollback >= 0 {
+		s.rollback(rollback)
+	}
+	if s.ended >= 0 && s.confirmed > s.ended {
+		s.finished = true
+	}
+	s.checkpoint()
+}
+
+// step は1フレーム進める。相手の入力が届いていなければ、最後に届いた入力が続くと予測する。
+func (s *NetSession) step() {
+	f := s.frame
+	remote := 1 - s.local
+	s.snapshots[f] = s.gs.Snapshot(f)
+	in, ok := s.inputs[remote][f]
+	if !ok {
+		in = s.inputs[remote][s.confirmed-1]
+		s.predicted[f] = in
+	}
+	s.current[s.local] = s.inputs[s.local][f]
+	s.current[remote] = in
+	next := s.gs.Step(s.dt)
+	s.frame++
+	if next != Scene(s.gs) {
+		s.ended, s.result = f, next
+	}
+}
+
+// rollback は from のフレームまで巻き戻し、今のフレームまで進め直す。進め直す間は音を鳴らさない。
+func (s *NetSession) rollback(from int) {
+	end := s.frame
+	s.gs.Restore(s.snapshots[from])
+	for f := from; f < end; f++ {
+		delete(s.predicted, f)
+	}
+	s.frame = from
+	s.ended, s.result = -1, nil
+	sound := s.gs.sound
+	s.gs.sound = nil
+	for s.frame < end && s.ended < 0 {
+		s.step()
+	}
+	s.gs.sound = sound
+	s.Rollbacks++
+}
+
+// checkpoint は入力が確定したフレームのチェックサムを送り、もう巻き戻さないフレームの記録を捨てる。
+func (s *NetSession) checkpoint() {
+	for s.nextSum < s.frame && s.nextSum <= s.confirmed {
+		sum := s.snapshots[s.nextSum].Checksum()
+		s.sums[0][s.nextSum] = sum
+		s.send(netMessage{Type: "sum", Frame: s.nextSum, Sum: sum})
+		s.compareSums(s.nextSum)
+		s.nextSum += checksumInterval
+	}
+
+	keep := min(s.confirmed, s.nextSum)
+	for f := range s.snapshots {
+		if f < keep {
+			delete(s.snapshots, f)
+		}
+	}
+	// 相手の入力は自分より先のフレームの分まで届いていることがあるので、進めたフレームより前だけ捨てる。
+	// 予測に使う最後の確定した入力は残す
+	done := min(s.confirmed, s.frame) - 1
+	for _, inputs := range s.inputs {
+		for f := range inputs {
+			if f < done {
+				delete(inputs, f)
+			}
+		}
+	}
+}
+
+func (s *NetSession) compareSums(frame int) {
+	local, ok1 := s.sums[0][frame]
+	peer, ok2 := s.sums[1][frame]
+	if !ok1 || !ok2 {
+		return
+	}
+	if local != peer {
+		s.err = &DesyncError{Frame: frame, Local: local, Peer: peer}
+	}
+	delete(s.sums[0], frame)
+	delete(s.sums[1], frame)
+}
+
+// NetResult は runNetplay が最後に表示するセッションの結果。
+type NetResult struct {
+	Role      string `json:"role"`
+	Frames    int    `json:"frames"`
+	Outcome   string `json:"outcome"`
+	Score     int    `json:"score"`
+	Checksum  string `json:"checksum"` // 最後のフレームの状態。2台で同じになるはず
+	Rollbacks int    `json:"rollbacks"`
+	Stalls    int    `json:"stalls"`
+}
+
+// runHeadless は画面を出さずに frames フレームか決着がつくまで進める。
+func (s *NetSession) runHeadless(frames int) (NetResult, error) {
+	for {
+		if result, ok := s.Result(); ok {
+			outcome := OutcomeDeath
+			if _, clear := result.(*StageClearScene); clear {
+				outcome = OutcomeClear
+			}
+			return s.headlessResult(outcome), nil
+		}
+		if s.frame >= frames {
+			s.Poll()
+			if s.confirmed >= frames && s.ended < 0 {
+				return s.headlessResult(OutcomeTimeout), nil
+			}
+			if s.peerLeft && s.err == nil {
+				s.err = errPeerLeft
+			}
+		} else if s.Tick() {
+			continue
+		}
+		if s.err != nil {
+			return NetResult{}, s.err
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *NetSession) headlessResult(outcome string) NetResult {
+	role := "host"
+	if s.local == 1 {
+		role = "join"
+	}
+	frame := s.frame
+	if s.ended >= 0 {
+		frame = s.ended + 1
+	}
+	return NetResult{
+		Role:      role,
+		Frames:    frame,
+		Outcome:   outcome,
+		Score:     s.gs.Score,
+		Checksum:  fmt.Sprintf("%016x", s.gs.Snapshot(frame).Checksum()),
+		Rollbacks: s.Rollbacks,
+		Stalls:    s.Stalls,
+	}
+}
+
+// runNetplay は netplay コマンド。画面を出さずにボット同士で通信対戦を行い、結果を表示する。
+// 2つのプロセスを -host と -join でつなぐか、-loopback で1つのプロセスの中の2台をつなぐ。
+// -loopback も 127.0.0.1 の TCP でつなぐので、本物の通信と同じようにバッファされる。
+func runNetplay(args []string) error {
+	fs := flag.NewFlagSet("netplay", flag.ExitOnError)
+	host := fs.String("host", "", "wait for a player on this address (e.g. :7777)")
+	join := fs.String("join", "", "join the host at this address (e.g. 127.0.0.1:7777)")
+	loopback := fs.Bool("loopback", false, "run both players in this process over a local TCP connection")
+	mazePath := fs.String("maze", "", "maze file for the host (default: built-in maze)")
+	seed := fs.Int64("seed", 1, "game seed for the host; bots use seed+player")
+	bot := fs.String("bot", "random", "player: autopilot, random, greedy, or a script file")
+	frames := fs.Int("frames", 3600, "stop after this many frames")
+	delay := fs.Int("delay", DefaultInputDelay, "input delay in frames (host)")
+	maxRollback := fs.Int("rollback", DefaultMaxRollback, "frames to predict ahead before waiting for the other player")
+	latency := fs.Duration("latency", 0, "artificial delay added to every message sent")
+	fs.Parse(args)
+
+	modes := 0
+	for _, set := range []bool{*host != "", *join != "", *loopback} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		return fmt.Errorf("specify exactly one of -host, -join and -loopback")
+	}
+	maze := DefaultMaze()
+	if *mazePath != "" {
+		var err error
+		if maze, err = LoadMaze(*mazePath); err != nil {
+			return err
+		}
+	}
+	newController, err := controllerFactory(*bot)
+	if err != nil {
+		return err
+	}
+	config := GameConfig{Seed: *seed}
+	netConfig := NetConfig{Delay: *delay, MaxRollback: *maxRollback, Latency: *latency}
+
+	start := func(conn net.Conn, local int) (NetResult, error) {
+		defer conn.Close()
+		source := newController(*seed + int64(local))
+		var session *NetSession
+		var err error
+		if local == 0 {
+			session, err = HostSession(conn, maze, config, netConfig, source)
+		} else {
+			session, err = JoinSession(conn, config, netConfig, source)
+		}
+		if err != nil {
+			return NetResult{}, err
+		}
+		session.Start()
+		result, err := session.runHeadless(*frames)
+		session.Close()
+		return result, err
+	}
+
+	var results []NetResult
+	switch {
+	case *loopback:
+		hostConn, joinConn, err := loopbackConns()
+		if err != nil {
+			return err
+		}
+		var wg sync.WaitGroup
+		results = make([]NetResult, 2)
+		errs := make([]error, 2)
+		for i, conn := range []net.Conn{hostConn, joinConn} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], errs[i] = start(conn, i)
+			}()
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	case *host != "":
+		listener, err := net.Listen("tcp", *host)
+		if err != nil {
+			return err
+		}
+		log.Printf("netplay: waiting for a player on %s", listener.Addr())
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			return err
+		}
+		result, err := start(conn, 0)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	default:
+		conn, err := net.DialTimeout("tcp", *join, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		result, err := start(conn, 1)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, result := range results {
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	if len(results) == 2 && results[0].Checksum != results[1].Checksum {
+		return fmt.Errorf("final states differ: %s, %s", results[0].Checksum, results[1].Checksum)
+	}
+	return nil
+}
+
+// loopbackConns は 127.0.0.1 の空いているポートで待ち受けて自分自身につなぎ、ホスト側と参加者側の接続を返す。
+func loopbackConns() (net.Conn, net.Conn, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer listener.Close()
+	joinConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		return nil, nil, err
+	}
+	hostConn, err := listener.Accept()
+	if err != nil {
+		joinConn.Close()
+		return nil, nil, err
+	}
+	return hostConn, joinConn, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startLoopbackSessions は 127.0.0.1 の TCP でつないだホストと参加者のセッションを作って始める。
+// どちらもランダムに動くボットで操作するので、相手の入力の予測は外れて巻き戻しが起きる。
+func startLoopbackSessions(t *testing.T, netConfig NetConfig) [2]*NetSession {
+	t.Helper()
+	hostConn, joinConn, err := loopbackConns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sessions [2]*NetSession
+	var errs [2]error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sessions[0], errs[0] = HostSession(hostConn, DefaultMaze(), GameConfig{Seed: 1}, netConfig, NewRandomController(1))
+	}()
+	go func() {
+		defer wg.Done()
+		sessions[1], errs[1] = JoinSession(joinConn, GameConfig{}, netConfig, NewRandomController(2))
+	}()
+	wg.Wait()
+	if err := errors.Join(errs[:]...); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sessions {
+		s.Start()
+		t.Cleanup(s.Close)
+	}
+	return sessions
+}
+
+// runLoopbackSessions は両方のセッションを frames フレームか決着がつくまで進める。
+// 先に止まった側がもう一方の待っているメッセージを捨てないよう、接続は両方が終わってから閉じる。
+func runLoopbackSessions(sessions [2]*NetSession, frames int) ([2]NetResult, [2]error) {
+	var results [2]NetResult
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, s := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.runHeadless(frames)
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+func TestNetSessionsStayInSync(t *testing.T) {
+	sessions := startLoopbackSessions(t, NetConfig{Latency: 10 * time.Millisecond})
+	results, errs := runLoopbackSessions(sessions, 600)
+	if err := errors.Join(errs[:]...); err != nil {
+		t.Fatal(err)
+	}
+	host, join := results[0], results[1]
+	if host.Frames != join.Frames || host.Outcome != join.Outcome {
+		t.Errorf("host ended with %s at frame %d, join with %s at frame %d", host.Outcome, host.Frames, join.Outcome, join.Frames)
+	}
+	if host.Checksum != join.Checksum {
+		t.Errorf("final checksums differ: host %s, join %s", host.Checksum, join.Checksum)
+	}
+	for i, r := range results {
+		if r.Rollbacks == 0 {
+			t.Errorf("session %d: no rollbacks with latency; the prediction was never corrected", i)
+		}
+	}
+}
+
+func TestNetSessionsDetectDesync(t *testing.T) {
+	sessions := startLoopbackSessions(t, NetConfig{Latency: 5 * time.Millisecond})
+	// 参加者のゲームだけ書き換えて、最初のチェックサムから食い違うようにする
+	sessions[1].Game().Score += 10
+	_, errs := runLoopbackSessions(sessions, 600)
+	for i, err := range errs {
+		var desync *DesyncError
+		if !errors.As(err, &desync) {
+			t.Errorf("session %d: err = %v, want a *DesyncError", i, err)
+			continue
+		}
+		if desync.Frame != 0 || desync.Local == desync.Peer {
+			t.Errorf("session %d: %v, want a mismatch at frame 0", i, desync)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const DefaultNetAddress = "127.0.0.1:7777"
+
+// NetMenuScene は通信対戦の HOST / JOIN と観戦の WATCH を選ぶ画面。アドレスは文字を打って変えられる。
+// HOST はアドレスのポートで待ち受け、JOIN はアドレスのホストにつなぎ、WATCH はアドレスの配信 (serve コマンド) を観る。
+type NetMenuScene struct {
+	app      *App
+	selected int
+	address  string
+
+	status   string // 待ち受け中・接続中などの表示
+	listener net.Listener
+	result   chan netConnectResult // 接続してセッションを始めたら届く
+}
+
+type netConnectResult struct {
+	session *NetSession
+	err     error
+}
+
+var netMenuItems = []string{"HOST", "JOIN", "WATCH"}
+
+func NewNetMenuScene(app *App) *NetMenuScene {
+	return &NetMenuScene{app: app, address: DefaultNetAddress}
+}
+
+// Host はアドレスのポートで相手を待ち受け始める。
+func (ns *NetMenuScene) Host() {
+	_, port, err := net.SplitHostPort(ns.address)
+	if err != nil {
+		ns.status = err.Error()
+		return
+	}
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		ns.status = err.Error()
+		return
+	}
+	ns.listener = listener
+	ns.status = "WAITING FOR PLAYER ON PORT " + port
+	ns.result = make(chan netConnectResult, 1)
+	maze, config := ns.app.Maze, ns.app.Config
+	config.Seed = ns.app.rng.Int63()
+	go func() {
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			ns.result <- netConnectResult{err: err}
+			return
+		}
+		session, err := HostSession(conn, maze, config, NetConfig{}, NewKeyboardController(ArrowKeys, 1))
+		if err != nil {
+			conn.Close()
+		}
+		ns.result <- netConnectResult{session, err}
+	}()
+}
+
+// Join はアドレスのホストにつなぐ。
+func (ns *NetMenuScene) Join() {
+	ns.status = "CONNECTING TO " + ns.address
+	ns.result = make(chan netConnectResult, 1)
+	address, config := ns.address, ns.app.Config
+	go func() {
+		conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+		if err != nil {
+			ns.result <- netConnectResult{err: err}
+			return
+		}
+		session, err := JoinSession(conn, config, NetConfig{}, NewKeyboardController(ArrowKeys, 1))
+		if err != nil {
+			conn.Close()
+		}
+		ns.result <- netConnectResult{session, err}
+	}()
+}
+
+// cancel は待ち受けをやめる。接続中の Join は結果を捨てる。
+func (ns *NetMenuScene) cancel() {
+	if ns.listener != nil {
+		ns.listener.Close()
+		ns.listener = nil
+	}
+	if result := ns.result; result != nil {
+		go func() {
+			if r := <-result; r.session != nil {
+				r.session.Close()
+			}
+		}()
+	}
+	ns.result = nil
+	ns.status = ""
+}
+
+func (ns *NetMenuScene) Update() Scene {
+	if ns.result != nil {
+		select {
+		case r := <-ns.result:
+			ns.result, ns.listener = nil, nil
+			if r.err != nil {
+				ns.status = r.err.Error()
+				return ns
+			}
+			r.session.Start()
+			return NewNetplayScene(r.session, ns.app.Config.Sound, ns.app.Title)
+		default:
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+			ns.cancel()
+		}
+		return ns
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		return ns.app.Title()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyArrowUp) {
+		ns.selected = (ns.selected + len(netMenuItems) - 1) % len(netMenuItems)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyArrowDown) {
+		ns.selected = (ns.selected + 1) % len(netMenuItems)
+	}
+	for _, c := range ebiten.AppendInputChars(nil) {
+		if strings.ContainsRune("0123456789.:-abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", c) {
+			ns.address += string(c)
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(ns.address) > 0 {
+		ns.address = ns.address[:len(ns.address)-1]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		switch netMenuItems[ns.selected] {
+		case "HOST":
+			ns.Host()
+		case "JOIN":
+			ns.Join()
+		case "WATCH":
+			return NewSpectatorScene(ns.address, ns.app.Title)
+		}
+	}
+	return ns
+}
+
+func (ns *NetMenuScene) Draw(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{R: 0, G: 0, B: 0, A: 255})
+	screenWidth, screenHeight := ScreenSize()
+	centerX := float32(screenWidth) / 2
+	top := float32(screenHeight)/2 - 70
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	gray := color.RGBA{R: 160, G: 160, B: 160, A: 255}
+
+	drawTextCentered(screen, "ONLINE", centerX, top, 4, PlayerColor)
+	for i, label := range netMenuItems {
+		clr := gray
+		if i == ns.selected {
+			clr = white
+			label = "> " + label
+		}
+		drawTextCentered(screen, label, centerX, top+40+float32(i)*24, 3, clr)
+	}
+	drawTextCentered(screen, ns.address, centerX, top+112, 2, white)
+	if ns.status != "" {
+		drawTextCentered(screen, ns.status, centerX, top+136, 2, ghostColors[2])
+	}
+}
+
+// NetplayScene は通信対戦のゲーム画面。自分は矢印キーと1台目のゲームパッドで操作する。
+type NetplayScene struct {
+	session *NetSession
+	exit    func() Scene
+}
+
+func NewNetplayScene(session *NetSession, sound *SoundManager, exit func() Scene) *NetplayScene {
+	gs := session.Game()
+	gs.sound = sound
+	gs.exit = exit
+	return &NetplayScene{session: session, exit: exit}
+}
+
+func (ns *NetplayScene) Update() Scene {
+	gs := ns.session.Game()
+	gs.handleSoundKeys()
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		gs.showMinimap = !gs.showMinimap
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		ns.session.Close()
+		gs.telemetry.Abort(OutcomeQuit)
+		gs.sound.StopAll()
+		return ns.exit()
+	}
+	if ns.session.Err() != nil {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+			ns.session.Close()
+			gs.telemetry.Abort(OutcomeQuit)
+			return ns.exit()
+		}
+		return ns
+	}
+	if result, ok := ns.session.Result(); ok {
+		ns.session.Close()
+		return result
+	}
+	if !gs.started {
+		gs.started = true
+		gs.sound.Play(SoundIntro)
+	}
+
+	ns.session.Poll()
+	gs.alpha = gs.clock.Advance(func(dt float64) bool {
+		return ns.session.Tick()
+	})
+	return ns
+}
+
+func (ns *NetplayScene) Draw(screen *ebiten.Image) {
+	ns.session.Game().Draw(screen)
+
+	screenWidth, screenHeight := ScreenSize()
+	centerX := float32(screenWidth) / 2
+	centerY := float32(screenHeight) / 2
+	message := ""
+	var desync *DesyncError
+	switch err := ns.session.Err(); {
+	case errors.As(err, &desync):
+		message = "DESYNC"
+	case errors.Is(err, errPeerLeft):
+		message = "PLAYER LEFT"
+	case err != nil:
+		message = "DISCONNECTED"
+	case ns.session.Waiting():
+		drawTextCentered(screen, "WAITING...", centerX, float32(screenHeight)-24, 2, ghostColors[2])
+		return
+	default:
+		return
+	}
+	vector.DrawFilledRect(screen, 0, centerY-30, float32(screenWidth), 60, color.RGBA{A: 200}, false)
+	drawTextCentered(screen, message, centerX, centerY-20, 4, color.RGBA{R: 255, A: 255})
+	drawTextCentered(screen, "PRESS ENTER", centerX, centerY+12, 2, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"container/heap"
+)
+
+// 迷路タイルの種類
+const (
+	TileEmpty       = 0
+	TileWall        = 1
+	TileDot         = 2
+	TilePellet      = 3
+	TileDoor        = 4 // ゴーストの巣の扉 (ゴーストのみ通過可)
+	TileTunnel      = 5 // 迷路の端でループするワープトンネル
+	TileOneWayUp    = 6 // このタイルからは矢印の方向にしか出られない
+	TileOneWayDown  = 7
+	TileOneWayLeft  = 8
+	TileOneWayRight = 9
+)
+
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func (p Point) Add(q Point) Point {
+	return Point{X: p.X + q.X, Y: p.Y + q.Y}
+}
+
+// 上・下・左・右 (Ghost の方向候補と同じ順序)
+var Directions = []Point{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+
+// Pathfinder は迷路のタイルグリッド上の経路探索を提供する。
+// 壁の配置が変わらない限り、ドットが食べられても結果は変わらない。
+type Pathfinder struct {
+	maze        [][]int
+	width       int
+	height      int
+	canUseDoors bool
+	dist        [][]int32 // Precompute 後の全点対距離 (始点インデックス -> 終点インデックス)
+}
+
+func NewPathfinder(maze [][]int, canUseDoors bool) *Pathfinder {
+	pf := &Pathfinder{
+		maze:        maze,
+		height:      len(maze),
+		canUseDoors: canUseDoors,
+	}
+	if pf.height > 0 {
+		pf.width = len(maze[0])
+	}
+	return pf
+}
+
+func (pf *Pathfinder) InBounds(p Point) bool {
+	return p.X >= 0 && p.X < pf.width && p.Y >= 0 && p.Y < pf.height
+}
+
+func (pf *Pathfinder) Walkable(p Point) bool {
+	if !pf.InBounds(p) {
+		return false
+	}
+	switch pf.maze[p.Y][p.X] {
+	case TileWall:
+		return false
+	case TileDoor:
+		return pf.canUseDoors
+	}
+	return true
+}
+
+// Step は p から dir 方向に1タイル進んだ先を返す。
+// トンネルからの画面外への移動は反対側に折り返し、一方通行タイルは指定方向以外を拒否する。
+func (pf *Pathfinder) Step(p Point, dir Point) (Point, bool) {
+	if !pf.Walkable(p) {
+		return p, false
+	}
+	if !oneWayAllows(pf.maze[p.Y][p.X], dir) {
+		return p, false
+	}
+
+	next := p.Add(dir)
+	if !pf.InBounds(next) {
+		if pf.maze[p.Y][p.X] != TileTunnel {
+			return p, false
+		}
+		next.X = (next.X + pf.width) % pf.width
+		next.Y = (next.Y + pf.height) % pf.height
+	}
+	if !pf.Walkable(next) {
+		return p, false
+	}
+	return next, true
+}
+
+func oneWayAllows(tile int, dir Point) bool {
+	switch tile {
+	case TileOneWayUp:
+		return dir == Point{0, -1}
+	case TileOneWayDown:
+		return dir == Point{0, 1}
+	case TileOneWayLeft:
+		return dir == Point{-1, 0}
+	case TileOneWayRight:
+		return dir == Point{1, 0}
+	}
+	return true
+}
+
+func (pf *Pathfinder) Neighbors(p Point) []Point {
+	var neighbors []Point
+	for _, dir := range Directions {
+		if next, ok := pf.Step(p, dir); ok {
+			neighbors = append(neighbors, next)
+		}
+	}
+	return neighbors
+}
+
+func (pf *Pathfinder) index(p Point) int {
+	return p.Y*pf.width + p.X
+}
+
+func (pf *Pathfinder) point(i int) Point {
+	return Point{X: i % pf.width, Y: i / pf.width}
+}
+
+// BFS は from から to への最短経路を返す。経路は from を含まず to を含む。
+// 到達できない場合は nil を返す。
+func (pf *Pathfinder) BFS(from, to Point) []Point {
+	if !pf.Walkable(from) || !pf.Walkable(to) {
+		return nil
+	}
+	if from == to {
+		return []Point{}
+	}
+
+	prev := make([]int, pf.width*pf.height)
+	for i := range prev {
+		prev[i] = -1
+	}
+	start := pf.index(from)
+	prev[start] = start
+
+	queue := []Point{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == to {
+			return pf.buildPath(prev, from, to)
+		}
+		for _, next := range pf.Neighbors(current) {
+			if prev[pf.index(next)] != -1 {
+				continue
+			}
+			prev[pf.index(next)] = pf.index(current)
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// AStar は BFS と同じ経路を、トンネルを考慮したマンハッタン距離をヒューリスティックとして探索する。
+func (pf *Pathfinder) AStar(from, to Point) []Point {
+	if !pf.Walkable(from) || !pf.Walkable(to) {
+		return nil
+	}
+	if from == to {
+		return []Point{}
+	}
+
+	size := pf.width * pf.height
+	prev := make([]int, size)
+	cost := make([]int, size)
+	for i := range prev {
+		prev[i] = -1
+		cost[i] = -1
+	}
+	start := pf.index(from)
+	prev[start] = start
+	cost[start] = 0
+
+	open := &nodeQueue{{index: start, priority: pf.heuristic(from, to)}}
+	for open.Len() > 0 {
+		node := heap.Pop(open).(pathNode)
+		current := pf.point(node.index)
+		if current == to {
+			return pf.buildPath(prev, from, to)
+		}
+		if node.priority-pf.heuristic(current, to) > cost[node.index] {
+			continue // より良い経路で既に展開済み
+		}
+		for _, next := range pf.Neighbors(current) {
+			i := pf.index(next)
+			newCost := cost[node.index] + 1
+			if cost[i] != -1 && cost[i] <= newCost {
+				continue
+			}
+			cost[i] = newCost
+			prev[i] = node.index
+			heap.Push(open, pathNode{index: i, priority: newCost + pf.heuristic(next, to)})
+		}
+	}
+	return nil
+}
+
+func (pf *Pathfinder) heuristic(a, b Point) int {
+	dx := a.X - b.X
+	if dx < 0 {
+		dx = -dx
+	}
+	dy := a.Y - b.Y
+	if dy < 0 {
+		dy = -dy
+	}
+	// トンネルで反対側へ回り込む方が近い場合もあるので、短い方を採用して許容的に保つ
+	if pf.width-dx < dx {
+		dx = pf.width - dx
+	}
+	if pf.height-dy < dy {
+		dy = pf.height - dy
+	}
+	return dx + dy
+}
+
+func (pf *Pathfinder) buildPath(prev []int, from, to Point) []Point {
+	var path []Point
+	for current := pf.index(to); current != pf.index(from); current = prev[current] {
+		path = append(path, pf.point(current))
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// DistanceField は from から各タイルへの歩数を返す (インデックスは y*width+x)。
+// 到達できないタイルは -1。
+func (pf *Pathfinder) DistanceField(from Point) []int32 {
+	field := make([]int32, pf.width*pf.height)
+	for i := range field {
+		field[i] = -1
+	}
+	if !pf.Walkable(from) {
+		return field
+	}
+
+	field[pf.index(from)] = 0
+	queue := []Point{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range pf.Neighbors(current) {
+			if field[pf.index(next)] != -1 {
+				continue
+			}
+			field[pf.index(next)] = field[pf.index(current)] + 1
+			queue = append(queue, next)
+		}
+	}
+	return field
+}
+
+// Precompute は全タイル間の距離を計算しておき、以降の Distance を定数時間にする。
+func (pf *Pathfinder) Precompute() {
+	pf.dist = make([][]int32, pf.width*pf.height)
+	for i := range pf.dist {
+		if pf.Walkable(pf.point(i)) {
+			pf.dist[i] = pf.DistanceField(pf.point(i))
+		}
+	}
+}
+
+// Distance は from から to への歩数を返す。到達できない場合は -1。
+func (pf *Pathfinder) Distance(from, to Point) int {
+	if !pf.InBounds(from) || !pf.InBounds(to) {
+		return -1
+	}
+	if pf.dist != nil {
+		field := pf.dist[pf.index(from)]
+		if field == nil {
+			return -1
+		}
+		return int(field[pf.index(to)])
+	}
+	path := pf.BFS(from, to)
+	if path == nil {
+		return -1
+	}
+	return len(path)
+}
+
+// NextDirection は from から to へ最短で向かうための最初の一歩の方向を返す。
+func (pf *Pathfinder) NextDirection(from, to Point) (Point, bool) {
+	best := Point{}
+	bestDistance := -1
+	for _, dir := range Directions {
+		next, ok := pf.Step(from, dir)
+		if !ok {
+			continue
+		}
+		distance := pf.Distance(next, to)
+		if distance < 0 {
+			continue
+		}
+		if bestDistance < 0 || distance < bestDistance {
+			bestDistance = distance
+			best = dir
+		}
+	}
+	return best, bestDistance >= 0
+}
+
+type pathNode struct {
+	index    int
+	priority int
+}
+
+type nodeQueue []pathNode
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].priority < q[j].priority }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(pathNode)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	node := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return node
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func parseTestMaze(t testing.TB, text string) *Maze {
+	t.Helper()
+	m, err := ParseMaze(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func loadArcadeMaze(t testing.TB) *Maze {
+	t.Helper()
+	m, err := LoadMaze("mazes/arcade.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Width() != 28 || m.Height() != 31 {
+		t.Fatalf("arcade maze is %dx%d, want 28x31", m.Width(), m.Height())
+	}
+	return m
+}
+
+// findTunnel はトンネルのある行の左端と右端のタイルを返す。
+func findTunnel(t testing.TB, m *Maze) (Point, Point) {
+	t.Helper()
+	for y, row := range m.Tiles {
+		if row[0] == TileTunnel && row[len(row)-1] == TileTunnel {
+			return Point{X: 0, Y: y}, Point{X: len(row) - 1, Y: y}
+		}
+	}
+	t.Fatal("maze has no tunnel")
+	return Point{}, Point{}
+}
+
+func TestStepWrapsThroughTunnel(t *testing.T) {
+	m := loadArcadeMaze(t)
+	pf := NewPathfinder(m.Tiles, false)
+	left, right := findTunnel(t, m)
+
+	if next, ok := pf.Step(left, Point{X: -1, Y: 0}); !ok || next != right {
+		t.Errorf("Step(%v, left) = %v, %v; want %v, true", left, next, ok, right)
+	}
+	if next, ok := pf.Step(right, Point{X: 1, Y: 0}); !ok || next != left {
+		t.Errorf("Step(%v, right) = %v, %v; want %v, true", right, next, ok, left)
+	}
+
+	// 両端の隣同士はトンネルを通れば3歩
+	from, to := left.Add(Point{X: 1}), right.Add(Point{X: -1})
+	pf.Precompute()
+	if d := pf.Distance(from, to); d != 3 {
+		t.Errorf("Distance(%v, %v) = %d, want 3", from, to, d)
+	}
+	if path := pf.BFS(from, to); len(path) != 3 || path[0] != left || path[1] != right {
+		t.Errorf("BFS(%v, %v) = %v, want a path through the tunnel", from, to, path)
+	}
+	if path := pf.AStar(from, to); len(path) != 3 {
+		t.Errorf("AStar(%v, %v) = %v, want 3 steps", from, to, path)
+	}
+}
+
+func TestOneWayTiles(t *testing.T) {
+	m := parseTestMaze(t, "#####\n#P>.#\n#...#\n#####\n")
+	pf := NewPathfinder(m.Tiles, false)
+	oneWay := Point{X: 2, Y: 1}
+
+	if _, ok := pf.Step(oneWay, Point{X: -1, Y: 0}); ok {
+		t.Error("left step out of a right-only tile is allowed")
+	}
+	if _, ok := pf.Step(oneWay, Point{X: 0, Y: 1}); ok {
+		t.Error("down step out of a right-only tile is allowed")
+	}
+	if next, ok := pf.Step(oneWay, Point{X: 1, Y: 0}); !ok || next != (Point{X: 3, Y: 1}) {
+		t.Errorf("Step(%v, right) = %v, %v", oneWay, next, ok)
+	}
+	// 入るのはどちらからでもよい
+	if next, ok := pf.Step(Point{X: 1, Y: 1}, Point{X: 1, Y: 0}); !ok || next != oneWay {
+		t.Errorf("entering the one-way tile = %v, %v", next, ok)
+	}
+
+	// 右へは通り抜けられるが、左へは下の行を回り道する
+	pf.Precompute()
+	if d := pf.Distance(Point{X: 1, Y: 1}, Point{X: 3, Y: 1}); d != 2 {
+		t.Errorf("distance with the arrow = %d, want 2", d)
+	}
+	if d := pf.Distance(Point{X: 3, Y: 1}, Point{X: 1, Y: 1}); d != 4 {
+		t.Errorf("distance against the arrow = %d, want 4", d)
+	}
+	if path := pf.BFS(Point{X: 3, Y: 1}, Point{X: 1, Y: 1}); len(path) != 4 {
+		t.Errorf("BFS against the arrow = %v, want 4 steps", path)
+	}
+	if path := pf.AStar(Point{X: 3, Y: 1}, Point{X: 1, Y: 1}); len(path) != 4 {
+		t.Errorf("AStar against the arrow = %v, want 4 steps", path)
+	}
+}
+
+func TestDoorsNeedCanUseDoors(t *testing.T) {
+	m := parseTestMaze(t, "#####\n#P=.#\n#####\n")
+	from, to := Point{X: 1, Y: 1}, Point{X: 3, Y: 1}
+
+	player := NewPathfinder(m.Tiles, false)
+	player.Precompute()
+	if path := player.BFS(from, to); path != nil {
+		t.Errorf("BFS through a door without CanUseDoors = %v, want nil", path)
+	}
+	if path := player.AStar(from, to); path != nil {
+		t.Errorf("AStar through a door without CanUseDoors = %v, want nil", path)
+	}
+	if d := player.Distance(from, to); d != -1 {
+		t.Errorf("Distance through a door without CanUseDoors = %d, want -1", d)
+	}
+
+	ghost := NewPathfinder(m.Tiles, true)
+	ghost.Precompute()
+	if path := ghost.BFS(from, to); len(path) != 2 {
+		t.Errorf("BFS through a door with CanUseDoors = %v, want 2 steps", path)
+	}
+	if d := ghost.Distance(from, to); d != 2 {
+		t.Errorf("Distance through a door with CanUseDoors = %d, want 2", d)
+	}
+
+	// Actor の当たり判定も同じ規則に従う
+	actor := Actor{}
+	if !actor.blocks(TileDoor) {
+		t.Error("door does not block an actor without CanUseDoors")
+	}
+	actor.CanUseDoors = true
+	if actor.blocks(TileDoor) {
+		t.Error("door blocks an actor with CanUseDoors")
+	}
+}
+
+// arcadeBenchmarkPoints はアーケード迷路の左上と右下の角の通路。
+func arcadeBenchmarkPoints(b *testing.B) (*Pathfinder, Point, Point) {
+	m := loadArcadeMaze(b)
+	return NewPathfinder(m.Tiles, false), Point{X: 1, Y: 1}, Point{X: 26, Y: 29}
+}
+
+func BenchmarkBFS(b *testing.B) {
+	pf, from, to := arcadeBenchmarkPoints(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if pf.BFS(from, to) == nil {
+			b.Fatal("no path")
+		}
+	}
+}
+
+func BenchmarkAStar(b *testing.B) {
+	pf, from, to := arcadeBenchmarkPoints(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if pf.AStar(from, to) == nil {
+			b.Fatal("no path")
+		}
+	}
+}
+
+func BenchmarkPrecompute(b *testing.B) {
+	m := loadArcadeMaze(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewPathfinder(m.Tiles, false).Precompute()
+	}
+}
+
+func BenchmarkDistance(b *testing.B) {
+	pf, from, to := arcadeBenchmarkPoints(b)
+	pf.Precompute()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if pf.Distance(from, to) < 0 {
+			b.Fatal("no path")
+		}
+	}
+}
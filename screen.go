@@ -0,0 +1,75 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// 論理解像度 (ゲーム内の座標系での画面サイズ)。読み込んだ迷路の大きさから決まり、
+// すべてのシーンは ScreenSize で取得する。
+var (
+	screenWidth  = 16 * TileSize
+	screenHeight = 10 * TileSize
+
+	// 論理画面を実際のウィンドウに描くときの拡大率と余白 (デバイスピクセル)
+	viewScale   = 1
+	viewOffsetX = 0
+	viewOffsetY = 0
+)
+
+func ScreenSize() (int, int) {
+	return screenWidth, screenHeight
+}
+
+// 論理解像度の上限 (タイル数)。これより大きな迷路はカメラでスクロールして表示する
+const (
+	MaxScreenTilesX = 28
+	MaxScreenTilesY = 22
+)
+
+// SetScreenSizeForMaze は迷路全体が収まるように論理解像度を設定する。
+// 迷路が上限より大きい場合は上限の大きさにする。
+func SetScreenSizeForMaze(m *Maze) {
+	screenWidth = min(m.Width(), MaxScreenTilesX) * TileSize
+	screenHeight = min(m.Height(), MaxScreenTilesY) * TileSize
+}
+
+// SetScreenSize は論理解像度をピクセル単位で直接設定する。
+func SetScreenSize(width, height int) {
+	screenWidth = width
+	screenHeight = height
+}
+
+// MazeFitsScreen は迷路全体が一画面に収まるかどうかを返す。
+func MazeFitsScreen(maze [][]int) bool {
+	return len(maze[0])*TileSize <= screenWidth && len(maze)*TileSize <= screenHeight
+}
+
+// LogicalCursorPosition はマウスカーソルの位置を論理画面の座標で返す。
+// CursorPosition は Layout の座標 (LayoutF で拡大率を掛けた後) なので、そのまま余白と拡大率を戻せばよい。
+func LogicalCursorPosition() (int, int) {
+	x, y := ebiten.CursorPosition()
+	return (x - viewOffsetX) / viewScale, (y - viewOffsetY) / viewScale
+}
+
+// presentScaled は論理画面 canvas を、縦横比を保った整数倍で screen の中央に描き、余白は黒帯にする。
+func presentScaled(screen, canvas *ebiten.Image) {
+	outW := screen.Bounds().Dx()
+	outH := screen.Bounds().Dy()
+	w, h := canvas.Bounds().Dx(), canvas.Bounds().Dy()
+
+	viewScale = min(outW/w, outH/h)
+	if viewScale < 1 {
+		viewScale = 1
+	}
+	viewOffsetX = (outW - w*viewScale) / 2
+	viewOffsetY = (outH - h*viewScale) / 2
+
+	screen.Fill(color.Black)
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(viewScale), float64(viewScale))
+	op.GeoM.Translate(float64(viewOffsetX), float64(viewOffsetY))
+	op.Filter = ebiten.FilterNearest
+	screen.DrawImage(canvas, op)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ゲーム1回分の結果
+const (
+	OutcomeClear   = "clear"
+	OutcomeDeath   = "death"
+	OutcomeTimeout = "timeout" // 制限時間内に決着がつかなかった
+)
+
+type GameResult struct {
+	Game      int     `json:"game"`
+	Seed      int64   `json:"seed"`
+	Outcome   string  `json:"outcome"`
+	Score     int     `json:"score"`
+	Time      float64 `json:"time"` // 秒
+	DotsEaten int     `json:"dotsEaten"`
+	TotalDots int     `json:"totalDots"`
+	DeathX    int     `json:"deathX"` // 死亡したタイル。死亡していなければ -1
+	DeathY    int     `json:"deathY"`
+}
+
+// SimulateGame は1回のゲームを画面を使わずに最後まで (または maxTime 秒まで) 進める。
+func SimulateGame(maze *Maze, config GameConfig, maxTime float64) GameResult {
+	gs := NewGameScene(maze, config)
+	dt := gs.clock.Dt()
+	result := GameResult{Seed: config.Seed, Outcome: OutcomeTimeout, DeathX: -1, DeathY: -1}
+
+	for gs.elapsed < maxTime {
+		next := gs.Step(dt)
+		if next == Scene(gs) {
+			continue
+		}
+		switch next.(type) {
+		case *GameOverScene:
+			result.Outcome = OutcomeDeath
+			death := gs.players[0].Tile()
+			result.DeathX, result.DeathY = death.X, death.Y
+		case *StageClearScene:
+			result.Outcome = OutcomeClear
+		}
+		break
+	}
+
+	gs.telemetry.Abort(OutcomeTimeout)
+	result.Score = gs.Score
+	result.Time = gs.elapsed
+	result.TotalDots = gs.totalDots
+	result.DotsEaten = gs.totalDots - gs.dotsRemaining
+	return result
+}
+
+// RunSimulations は games 回のゲームを workers 個のゴルーチンで並列に実行する。
+// i 番目のゲームのシードは seed+i なので、並列数を変えても結果は変わらない。
+// シードはゴーストの出発の向き・巣を出るまでの時間・分かれ道での気まぐれな曲がり方と、
+// random ボットの選ぶ方向を決める。greedy と autopilot ボット自身は乱数を使わない。
+func RunSimulations(maze *Maze, config GameConfig, newController func(seed int64) Controller, games, workers int, seed int64, maxTime float64) []GameResult {
+	results := make([]GameResult, games)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				gameConfig := config
+				gameConfig.Seed = seed + int64(i)
+				gameConfig.Controllers = []Controller{newController(gameConfig.Seed)}
+				results[i] = SimulateGame(maze, gameConfig, maxTime)
+				results[i].Game = i
+			}
+		}()
+	}
+	for i := 0; i < games; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+type DeathCount struct {
+	X     int `json:"x"`
+	Y     int `json:"y"`
+	Count int `json:"count"`
+}
+
+type SimSummary struct {
+	Games          int          `json:"games"`
+	ClearRate      float64      `json:"clearRate"`
+	DeathRate      float64      `json:"deathRate"`
+	TimeoutRate    float64      `json:"timeoutRate"`
+	AverageScore   float64      `json:"averageScore"`
+	AverageTime    float64      `json:"averageTime"` // 決着までの時間 (秒)。タイムアウトは制限時間で数える
+	MedianTime     float64      `json:"medianTime"`
+	AverageCleared float64      `json:"averageCleared"` // 食べたドットの割合の平均
+	Deaths         []DeathCount `json:"deaths"`         // 死亡した場所。多い順
+}
+
+func Summarize(results []GameResult) SimSummary {
+	summary := SimSummary{Games: len(results), Deaths: []DeathCount{}}
+	if len(results) == 0 {
+		return summary
+	}
+
+	times := make([]float64, len(results))
+	deaths := map[Point]int{}
+	for i, r := range results {
+		switch r.Outcome {
+		case OutcomeClear:
+			summary.ClearRate++
+		case OutcomeDeath:
+			summary.DeathRate++
+			deaths[Point{X: r.DeathX, Y: r.DeathY}]++
+		case OutcomeTimeout:
+			summary.TimeoutRate++
+		}
+		summary.AverageScore += float64(r.Score)
+		summary.AverageTime += r.Time
+		if r.TotalDots > 0 {
+			summary.AverageCleared += float64(r.DotsEaten) / float64(r.TotalDots)
+		}
+		times[i] = r.Time
+	}
+
+	n := float64(len(results))
+	summary.ClearRate /= n
+	summary.DeathRate /= n
+	summary.TimeoutRate /= n
+	summary.AverageScore /= n
+	summary.AverageTime /= n
+	summary.AverageCleared /= n
+
+	sort.Float64s(times)
+	summary.MedianTime = times[len(times)/2]
+	if len(times)%2 == 0 {
+		summary.MedianTime = (times[len(times)/2-1] + times[len(times)/2]) / 2
+	}
+
+	for p, count := range deaths {
+		summary.Deaths = append(summary.Deaths, DeathCount{X: p.X, Y: p.Y, Count: count})
+	}
+	sort.Slice(summary.Deaths, func(i, j int) bool {
+		a, b := summary.Deaths[i], summary.Deaths[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.X < b.X
+	})
+	return summary
+}
+
+// controllerFactory は -bot の値からコントローラの作り方を返す。
+// autopilot, random, greedy のほかに、スクリプトファイルのパスを指定できる。
+func controllerFactory(bot string) (func(seed int64) Controller, error) {
+	switch bot {
+	case "random":
+		return func(seed int64) Controller { return NewRandomController(seed) }, nil
+	case "greedy":
+		return func(seed int64) Controller { return &GreedyController{} }, nil
+	case "autopilot":
+		return func(seed int64) Controller { return NewAutopilot() }, nil
+	}
+	steps, err := loadScript(bot)
+	if err != nil {
+		return nil, fmt.Errorf("-bot: %w", err)
+	}
+	return func(seed int64) Controller { return NewScriptController(steps) }, nil
+}
+
+// runSim は sim コマンド。画面を出さずに多数のゲームを実行して統計を出力する。
+func runSim(args []string) error {
+	fs := flag.NewFlagSet("sim", flag.ExitOnError)
+	mazePath := fs.String("maze", "", "maze file (default: built-in maze)")
+	games := fs.Int("games", 1000, "number of games to run")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of games to run in parallel")
+	seed := fs.Int64("seed", 1, "seed of the first game; game i uses seed+i. The seed sets ghost start directions, release delays and random turns")
+	bot := fs.String("bot", "random", "player: autopilot, random, greedy, or a script file of \"direction seconds\" lines")
+	maxTime := fs.Float64("max-time", 300, "give up on a game after this many simulated seconds")
+	rate := fs.Int("rate", DefaultSimulationRate, "simulation steps per second")
+	playerSpeed := fs.Float64("player-speed", PlayerSpeed, "player speed in tiles per second")
+	ghostSpeed := fs.Float64("ghost-speed", GhostSpeed, "ghost speed in tiles per second")
+	frightened := fs.Float64("frightened", FrightenedDuration, "frightened duration in seconds")
+	format := fs.String("format", "json", "output format: json or csv")
+	out := fs.String("o", "", "output file (default: stdout)")
+	telemetry := fs.String("telemetry", "", "write a JSON Lines log of every game into this directory (see the heatmap command)")
+	fs.Parse(args)
+
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if *games < 1 || *workers < 1 {
+		return fmt.Errorf("-games and -workers must be positive")
+	}
+	maze := DefaultMaze()
+	if *mazePath != "" {
+		var err error
+		if maze, err = LoadMaze(*mazePath); err != nil {
+			return err
+		}
+	}
+	newController, err := controllerFactory(*bot)
+	if err != nil {
+		return err
+	}
+	// カメラが画面サイズを参照するので、画面を出さなくても迷路に合わせておく
+	SetScreenSizeForMaze(maze)
+
+	config := GameConfig{
+		SimulationRate:     *rate,
+		PlayerSpeed:        *playerSpeed,
+		GhostSpeed:         *ghostSpeed,
+		FrightenedDuration: *frightened,
+		TelemetryDir:       *telemetry,
+	}
+	start := time.Now()
+	results := RunSimulations(maze, config, newController, *games, *workers, *seed, *maxTime)
+	summary := Summarize(results)
+	fmt.Fprintf(os.Stderr, "%d games in %v: clear %.1f%%, death %.1f%%, timeout %.1f%%, average score %.1f, median time %.1fs\n",
+		summary.Games, time.Since(start).Round(time.Millisecond), summary.ClearRate*100, summary.DeathRate*100,
+		summary.TimeoutRate*100, summary.AverageScore, summary.MedianTime)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "csv" {
+		return writeResultsCSV(w, results)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Maze               string       `json:"maze"`
+		Bot                string       `json:"bot"`
+		Seed               int64        `json:"seed"`
+		MaxTime            float64      `json:"maxTime"`
+		SimulationRate     int          `json:"rate"`
+		PlayerSpeed        float64      `json:"playerSpeed"`
+		GhostSpeed         float64      `json:"ghostSpeed"`
+		FrightenedDuration float64      `json:"frightened"`
+		Summary            SimSummary   `json:"summary"`
+		Results            []GameResult `json:"results"`
+	}{*mazePath, *bot, *seed, *maxTime, *rate, *playerSpeed, *ghostSpeed, *frightened, summary, results})
+}
+
+// writeResultsCSV はゲームごとの結果を1行ずつ CSV で書き出す。
+func writeResultsCSV(w io.Writer, results []GameResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write(strings.Split("game,seed,outcome,score,time,dots_eaten,total_dots,death_x,death_y", ","))
+	for _, r := range results {
+		cw.Write([]string{
+			strconv.Itoa(r.Game),
+			strconv.FormatInt(r.Seed, 10),
+			r.Outcome,
+			strconv.Itoa(r.Score),
+			strconv.FormatFloat(r.Time, 'f', 3, 64),
+			strconv.Itoa(r.DotsEaten),
+			strconv.Itoa(r.TotalDots),
+			strconv.Itoa(r.DeathX),
+			strconv.Itoa(r.DeathY),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
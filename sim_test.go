@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+// ボットは刻みの細かさによらず同じタイルで同じ方向を選ぶので、同じシードなら 30/60/120 Hz で同じ結果になる。
+func TestSimulationRateIndependent(t *testing.T) {
+	maze := DefaultMaze()
+	bots := map[string]func(seed int64) Controller{
+		"random":    func(seed int64) Controller { return NewRandomController(seed) },
+		"greedy":    func(int64) Controller { return &GreedyController{} },
+		"autopilot": func(int64) Controller { return NewAutopilot() },
+	}
+	for name, newController := range bots {
+		for seed := int64(1); seed <= 10; seed++ {
+			var want GameResult
+			for i, rate := range []int{60, 30, 120} {
+				config := GameConfig{Seed: seed, SimulationRate: rate, Controllers: []Controller{newController(seed)}}
+				got := SimulateGame(maze, config, 60)
+				// 終わった時刻はステップの区切りに丸められるので比べない
+				got.Time = 0
+				if i == 0 {
+					want = got
+					continue
+				}
+				if got != want {
+					t.Errorf("%s seed %d: %d Hz gave %+v, 60 Hz gave %+v", name, seed, rate, got, want)
+				}
+			}
+		}
+	}
+}
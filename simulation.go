@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	DefaultSimulationRate = 60   // 1秒あたりのシミュレーションステップ数
+	maxFrameTime          = 0.25 // 処理落ち時に一度に進める最大時間 (秒)
+)
+
+// FixedStep は描画フレームレートと無関係に、一定の刻み幅でシミュレーションを進める。
+// 経過時間をアキュムレータに溜め、刻み幅ぶん溜まるごとに1ステップ実行する。
+type FixedStep struct {
+	Rate        int
+	accumulator float64
+	last        time.Time
+}
+
+func NewFixedStep(rate int) *FixedStep {
+	if rate <= 0 {
+		rate = DefaultSimulationRate
+	}
+	return &FixedStep{Rate: rate}
+}
+
+func (fs *FixedStep) Dt() float64 {
+	return 1 / float64(fs.Rate)
+}
+
+// Reset は溜まった時間を捨てる。シミュレーションを止めていた後に、止めていた時間をまとめて進めないようにする。
+func (fs *FixedStep) Reset() {
+	fs.accumulator = 0
+	fs.last = time.Time{}
+}
+
+// Advance は前回呼び出しからの実時間を溜め、固定ステップごとに step を呼ぶ。
+// step が false を返したらそこで打ち切る。戻り値は描画用の補間係数 (0〜1)。
+func (fs *FixedStep) Advance(step func(dt float64) bool) float64 {
+	now := time.Now()
+	if fs.last.IsZero() {
+		fs.last = now
+	}
+	elapsed := now.Sub(fs.last).Seconds()
+	fs.last = now
+	if elapsed > maxFrameTime {
+		elapsed = maxFrameTime
+	}
+
+	fs.accumulator += elapsed
+	dt := fs.Dt()
+	for fs.accumulator >= dt {
+		fs.accumulator -= dt
+		if !step(dt) {
+			fs.accumulator = 0
+			return 1
+		}
+	}
+	return fs.accumulator / dt
+}
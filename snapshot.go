@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"math/rand"
+)
+
+// countingSource は乱数を何回引いたかを数える。状態を引いた回数だけで表せるので、
+// スナップショットに乱数の状態を丸ごと持たなくても、シードから引き直して巻き戻せる。
+type countingSource struct {
+	src   rand.Source
+	seed  int64
+	draws uint64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed), seed: seed}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.seed = seed
+	s.draws = 0
+}
+
+// rewind は draws 回引いた直後の状態に戻す。ゴーストが乱数を使うのは行き先が決まらないときだけなので、引き直しは少ない。
+func (s *countingSource) rewind(draws uint64) {
+	if draws < s.draws {
+		s.Seed(s.seed)
+	}
+	for s.draws < draws {
+		s.Int63()
+	}
+}
+
+// GameSnapshot はシミュレーションの状態の写し。巻き戻し (ロールバック) と同期ずれの検出に使う。
+// 描画だけに使うもの (補間係数やミニマップの表示切り替えなど) は含まない。
+type GameSnapshot struct {
+	Frame         int
+	tiles         []int
+	players       []Player
+	ghosts        []Ghost
+	score         int
+	dotsRemaining int
+	elapsed       float64
+	stats         GameStats
+	camera        Camera
+	rngDraws      uint64
+}
+
+// Snapshot は frame 番目のステップを始める前の状態として、今の状態を写し取る。
+func (gs *GameScene) Snapshot(frame int) *GameSnapshot {
+	s := &GameSnapshot{
+		Frame:         frame,
+		score:         gs.Score,
+		dotsRemaining: gs.dotsRemaining,
+		elapsed:       gs.elapsed,
+		stats:         gs.stats,
+		camera:        *gs.camera,
+		rngDraws:      gs.rngSource.draws,
+	}
+	for _, row := range gs.maze {
+		s.tiles = append(s.tiles, row...)
+	}
+	for _, player := range gs.players {
+		s.players = append(s.players, *player)
+	}
+	for _, ghost := range gs.ghosts {
+		s.ghosts = append(s.ghosts, *ghost)
+	}
+	return s
+}
+
+// Restore は s を写し取ったときの状態に戻す。変わったタイルは描画をやり直す。
+func (gs *GameScene) Restore(s *GameSnapshot) {
+	width := len(gs.maze[0])
+	for i, tile := range s.tiles {
+		gs.setTile(i%width, i/width, tile)
+	}
+	for i := range gs.players {
+		*gs.players[i] = s.players[i]
+	}
+	for i := range gs.ghosts {
+		*gs.ghosts[i] = s.ghosts[i]
+	}
+	gs.Score = s.score
+	gs.dotsRemaining = s.dotsRemaining
+	gs.elapsed = s.elapsed
+	gs.stepStart, gs.ghostsAt = s.elapsed, s.elapsed
+	gs.stats = s.stats
+	*gs.camera = s.camera
+	gs.rngSource.rewind(s.rngDraws)
+}
+
+// setTile はタイル (x, y) を tile にする。変わったときだけ描画をやり直す。
+func (gs *GameScene) setTile(x, y, tile int) {
+	if gs.maze[y][x] == tile {
+		return
+	}
+	gs.maze[y][x] = tile
+	gs.renderer.InvalidateDotAt(x, y)
+	gs.minimap.SetTile(x, y, tile)
+}
+
+// Checksum はゲームの結果に関わる状態のハッシュを返す。同じ入力で進めた2つのゲームは同じ値になる。
+func (s *GameSnapshot) Checksum() uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	putInt := func(v int64) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		h.Write(buf[:])
+	}
+	putFloat := func(v float64) {
+		putInt(int64(math.Float64bits(v)))
+	}
+	putActor := func(a *Actor) {
+		putFloat(a.X)
+		putFloat(a.Y)
+		putFloat(a.DirX)
+		putFloat(a.DirY)
+	}
+
+	putInt(int64(s.Frame))
+	for _, tile := range s.tiles {
+		putInt(int64(tile))
+	}
+	for i := range s.players {
+		p := &s.players[i]
+		putActor(&p.Actor)
+		putInt(int64(p.Score))
+		putInt(int64(p.Lives))
+	}
+	for i := range s.ghosts {
+		g := &s.ghosts[i]
+		putActor(&g.Actor)
+		putInt(int64(g.State))
+		putFloat(g.FrightenedTimer)
+		putInt(int64(g.Catches))
+		putInt(int64(g.decided.X))
+		putInt(int64(g.decided.Y))
+		putFloat(g.releaseTimer)
+		putFloat(g.stateSince)
+		putInt(int64(g.turns))
+	}
+	putInt(int64(s.score))
+	putInt(int64(s.dotsRemaining))
+	putFloat(s.elapsed)
+	putInt(int64(s.rngDraws))
+	return h.Sum64()
+}
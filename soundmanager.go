@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+// SoundManager は生成した効果音を ebiten/audio で再生する。
+// nil のまま使うと何もしないので、ヘッドレス実行時は作らなくてよい。
+type SoundManager struct {
+	context *audio.Context
+	buffers map[SoundID][]byte
+	playing map[SoundID]*audio.Player
+	loop    *audio.Player
+	loopID  SoundID
+	volume  float64
+	muted   bool
+	chompKa bool
+}
+
+func NewSoundManager(volume float64, muted bool) *SoundManager {
+	sm := &SoundManager{
+		context: audio.NewContext(SampleRate),
+		buffers: map[SoundID][]byte{},
+		playing: map[SoundID]*audio.Player{},
+		loopID:  -1,
+		volume:  volume,
+		muted:   muted,
+	}
+	for _, id := range AllSounds {
+		sm.buffers[id] = StereoF32Bytes(GenerateSound(id))
+	}
+	return sm
+}
+
+func (sm *SoundManager) effectiveVolume() float64 {
+	if sm.muted {
+		return 0
+	}
+	return sm.volume
+}
+
+// Play は効果音を最初から再生する。同じ音が鳴っていれば止めてから鳴らし直す。
+func (sm *SoundManager) Play(id SoundID) {
+	if sm == nil {
+		return
+	}
+	if p, ok := sm.playing[id]; ok {
+		p.Close()
+	}
+	p := sm.context.NewPlayerF32FromBytes(sm.buffers[id])
+	p.SetVolume(sm.effectiveVolume())
+	p.Play()
+	sm.playing[id] = p
+}
+
+// IsPlaying は効果音 id が再生中かどうかを返す。
+func (sm *SoundManager) IsPlaying(id SoundID) bool {
+	if sm == nil {
+		return false
+	}
+	p, ok := sm.playing[id]
+	return ok && p.IsPlaying()
+}
+
+// PlayChomp はドットを食べるたびに「ワ」と「カ」を交互に鳴らす。
+func (sm *SoundManager) PlayChomp() {
+	if sm == nil {
+		return
+	}
+	if sm.chompKa {
+		sm.Play(SoundKa)
+	} else {
+		sm.Play(SoundWa)
+	}
+	sm.chompKa = !sm.chompKa
+}
+
+// PlayLoop は BGM をループ再生する。既に同じ音がループしていれば何もしない。
+func (sm *SoundManager) PlayLoop(id SoundID) {
+	if sm == nil || sm.loopID == id {
+		return
+	}
+	sm.StopLoop()
+	buf := sm.buffers[id]
+	loop := audio.NewInfiniteLoopF32(bytes.NewReader(buf), int64(len(buf)))
+	p, err := sm.context.NewPlayerF32(loop)
+	if err != nil {
+		return
+	}
+	p.SetVolume(sm.effectiveVolume())
+	p.Play()
+	sm.loop = p
+	sm.loopID = id
+}
+
+func (sm *SoundManager) StopLoop() {
+	if sm == nil || sm.loop == nil {
+		return
+	}
+	sm.loop.Close()
+	sm.loop = nil
+	sm.loopID = -1
+}
+
+// StopAll は再生中の音をすべて止める。シーンを抜けるときに呼ぶ
+func (sm *SoundManager) StopAll() {
+	if sm == nil {
+		return
+	}
+	sm.StopLoop()
+	for id, p := range sm.playing {
+		p.Close()
+		delete(sm.playing, id)
+	}
+}
+
+func (sm *SoundManager) Volume() float64 {
+	if sm == nil {
+		return 0
+	}
+	return sm.volume
+}
+
+func (sm *SoundManager) SetVolume(volume float64) {
+	if sm == nil {
+		return
+	}
+	if volume < 0 {
+		volume = 0
+	} else if volume > 1 {
+		volume = 1
+	}
+	sm.volume = volume
+	sm.applyVolume()
+}
+
+func (sm *SoundManager) Muted() bool {
+	return sm != nil && sm.muted
+}
+
+func (sm *SoundManager) ToggleMute() {
+	if sm == nil {
+		return
+	}
+	sm.muted = !sm.muted
+	sm.applyVolume()
+}
+
+func (sm *SoundManager) applyVolume() {
+	for _, p := range sm.playing {
+		p.SetVolume(sm.effectiveVolume())
+	}
+	if sm.loop != nil {
+		sm.loop.SetVolume(sm.effectiveVolume())
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+type SoundID int
+
+const (
+	SoundWa SoundID = iota // ドットを食べたときの「ワ」
+	SoundKa                // 「カ」。ワと交互に鳴らしてワカワカ音にする
+	SoundPowerPellet
+	SoundGhostEaten
+	SoundDeath
+	SoundExtraLife
+	SoundIntro
+	SoundEyes // 食べられたゴーストの目が巣に戻る間の音
+	// 通常時のサイレン。残りのドットが減るほど高く速くなる
+	SoundSiren1
+	SoundSiren2
+	SoundSiren3
+	SoundSiren4
+	SoundSiren5
+)
+
+const sirenLevels = 5
+
+// AllSounds は SoundManager が起動時に生成しておく音の一覧。
+var AllSounds = []SoundID{
+	SoundWa, SoundKa, SoundPowerPellet, SoundGhostEaten, SoundDeath, SoundExtraLife, SoundIntro,
+	SoundEyes, SoundSiren1, SoundSiren2, SoundSiren3, SoundSiren4, SoundSiren5,
+}
+
+// SirenForProgress は残りのドットの割合 (1 = 開始時、0 = 全部食べた) に応じたサイレンを返す。
+func SirenForProgress(remaining, total int) SoundID {
+	if total <= 0 {
+		return SoundSiren1
+	}
+	cleared := 1 - float64(remaining)/float64(total)
+	level := int(cleared * sirenLevels)
+	if level >= sirenLevels {
+		level = sirenLevels - 1
+	}
+	return SoundSiren1 + SoundID(level)
+}
+
+// GenerateSound は効果音・BGM のサンプル列を生成する。音声ファイルは使わない。
+func GenerateSound(id SoundID) []float32 {
+	synth := NewSynth(SampleRate)
+	switch id {
+	case SoundWa:
+		return synth.Render([]Note{
+			{Wave: WaveTriangle, Freq: 520, FreqEnd: 260, Duration: 0.09, Volume: 0.5, Env: Envelope{Attack: 0.005, Sustain: 1, Release: 0.02}},
+		})
+	case SoundKa:
+		return synth.Render([]Note{
+			{Wave: WaveTriangle, Freq: 260, FreqEnd: 520, Duration: 0.09, Volume: 0.5, Env: Envelope{Attack: 0.005, Sustain: 1, Release: 0.02}},
+		})
+	case SoundPowerPellet:
+		// 低い音から高い音へ素早く繰り返すサイレン
+		var notes []Note
+		for i := 0; i < 8; i++ {
+			notes = append(notes, Note{Wave: WaveSquare, Freq: 200, FreqEnd: 700, Duration: 0.0625, Volume: 0.15, Duty: 0.25})
+		}
+		return synth.Render(notes)
+	case SoundGhostEaten:
+		return synth.Render([]Note{
+			{Wave: WaveSquare, Freq: 150, FreqEnd: 1400, Duration: 0.35, Volume: 0.25, Duty: 0.125, Env: Envelope{Sustain: 1, Release: 0.05}},
+		})
+	case SoundDeath:
+		var notes []Note
+		for i := 0; i < 9; i++ {
+			start := 900 - float64(i)*80
+			notes = append(notes, Note{Wave: WaveSquare, Freq: start, FreqEnd: start - 250, Duration: 0.13, Volume: 0.25, Env: Envelope{Sustain: 1, Release: 0.02}})
+		}
+		notes = append(notes,
+			Note{Wave: WaveNoise, Freq: 2000, FreqEnd: 200, Duration: 0.12, Volume: 0.3, Env: Envelope{Sustain: 1, Release: 0.1}},
+			Note{Wave: WaveNoise, Freq: 2000, FreqEnd: 200, Duration: 0.12, Volume: 0.3, Env: Envelope{Sustain: 1, Release: 0.1}},
+		)
+		return synth.Render(notes)
+	case SoundExtraLife:
+		var notes []Note
+		for i := 0; i < 6; i++ {
+			notes = append(notes,
+				Note{Wave: WaveSquare, Freq: noteFreq(88), Duration: 0.08, Volume: 0.2, Env: Envelope{Sustain: 1, Release: 0.02}},
+				Note{Duration: 0.04},
+			)
+		}
+		return synth.Render(notes)
+	case SoundIntro:
+		return generateIntro(synth)
+	case SoundEyes:
+		var notes []Note
+		for i := 0; i < 6; i++ {
+			notes = append(notes, Note{Wave: WaveSquare, Freq: 1200, FreqEnd: 500, Duration: 0.08, Volume: 0.12, Duty: 0.125})
+		}
+		return synth.Render(notes)
+	case SoundSiren1, SoundSiren2, SoundSiren3, SoundSiren4, SoundSiren5:
+		return generateSiren(synth, int(id-SoundSiren1))
+	}
+	return nil
+}
+
+// generateIntro はゲーム開始時のジングル。矩形波のメロディと三角波のベースを重ねる。
+func generateIntro(synth *Synth) []float32 {
+	const beat = 0.13
+	melody := []struct {
+		midi  int
+		beats float64
+	}{
+		{71, 1}, {83, 1}, {78, 1}, {75, 1}, {83, 0.5}, {78, 1.5}, {75, 2},
+		{72, 1}, {84, 1}, {79, 1}, {76, 1}, {84, 0.5}, {79, 1.5}, {76, 2},
+		{71, 1}, {83, 1}, {78, 1}, {75, 1}, {83, 0.5}, {78, 1.5}, {75, 2},
+		{75, 0.5}, {76, 0.5}, {77, 1}, {77, 0.5}, {78, 0.5}, {79, 1}, {79, 0.5}, {80, 0.5}, {81, 1}, {83, 2},
+	}
+	bass := []struct {
+		midi  int
+		beats float64
+	}{
+		{47, 3}, {59, 1}, {47, 3}, {59, 1},
+		{48, 3}, {60, 1}, {48, 3}, {60, 1},
+		{47, 3}, {59, 1}, {47, 3}, {59, 1},
+		{54, 2}, {56, 2}, {58, 2}, {59, 2},
+	}
+
+	var melodyNotes []Note
+	for _, n := range melody {
+		melodyNotes = append(melodyNotes, Note{Wave: WaveSquare, Freq: noteFreq(n.midi), Duration: n.beats * beat, Volume: 0.2, Env: Envelope{Attack: 0.005, Decay: 0.05, Sustain: 0.7, Release: 0.02}})
+	}
+	var bassNotes []Note
+	for _, n := range bass {
+		bassNotes = append(bassNotes, Note{Wave: WaveTriangle, Freq: noteFreq(n.midi), Duration: n.beats * beat, Volume: 0.35, Env: Envelope{Sustain: 1, Release: 0.02}})
+	}
+	return Mix(synth.Render(melodyNotes), NewSynth(synth.SampleRate).Render(bassNotes))
+}
+
+// generateSiren は上下にうねる三角波のサイレンを4周期分生成する (ループ再生用)。
+// level が上がるほど音程が上がり、うねりの周期が短くなる。
+func generateSiren(synth *Synth, level int) []float32 {
+	low := 350 + float64(level)*70
+	high := low * 1.6
+	period := 0.4 - float64(level)*0.05
+	var notes []Note
+	for i := 0; i < 4; i++ {
+		notes = append(notes,
+			Note{Wave: WaveTriangle, Freq: low, FreqEnd: high, Duration: period / 2, Volume: 0.25},
+			Note{Wave: WaveTriangle, Freq: high, FreqEnd: low, Duration: period / 2, Volume: 0.25},
+		)
+	}
+	return synth.Render(notes)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"image/color"
+	"net"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// SpectatorScene は serve コマンドの配信を受け取って描く観戦画面。操作はできない。
+// 受け取った状態を GameScene に書き込み、描画は GameScene に任せる。
+type SpectatorScene struct {
+	address  string
+	status   string
+	messages chan streamMessage
+	done     chan struct{}
+
+	gs        *GameScene
+	interval  float64   // state の間隔 (秒)。この間で位置を補間する
+	lastState time.Time // 最後に state を受け取った時刻
+	lastFrame time.Time
+	outcome   string
+	score     int
+	exit      func() Scene
+}
+
+func NewSpectatorScene(address string, exit func() Scene) *SpectatorScene {
+	ss := &SpectatorScene{
+		address:  address,
+		status:   "CONNECTING TO " + address,
+		messages: make(chan streamMessage, 256),
+		done:     make(chan struct{}),
+		exit:     exit,
+	}
+	go ss.receive()
+	return ss
+}
+
+// receive は配信を読んで messages に送る。エラーのときは type が "error" のメッセージを送る。
+func (ss *SpectatorScene) receive() {
+	conn, err := net.DialTimeout("tcp", ss.address, 5*time.Second)
+	if err == nil {
+		select {
+		case <-ss.done:
+			conn.Close()
+			return
+		case ss.messages <- streamMessage{Type: "connected"}:
+		}
+		defer conn.Close()
+		dec := json.NewDecoder(conn)
+		for {
+			var msg streamMessage
+			if err = dec.Decode(&msg); err != nil {
+				break
+			}
+			select {
+			case ss.messages <- msg:
+			case <-ss.done:
+				return
+			}
+		}
+	}
+	select {
+	case ss.messages <- streamMessage{Type: "error", Outcome: err.Error()}:
+	case <-ss.done:
+	}
+}
+
+// close は受信をやめる。受信中の接続は次のメッセージを受け取った時点で閉じる。
+func (ss *SpectatorScene) close() {
+	close(ss.done)
+}
+
+func (ss *SpectatorScene) Update() Scene {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) && ss.exit != nil {
+		ss.close()
+		return ss.exit()
+	}
+	for {
+		select {
+		case msg := <-ss.messages:
+			ss.apply(msg)
+			continue
+		default:
+		}
+		break
+	}
+
+	now := time.Now()
+	if ss.gs != nil {
+		if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+			ss.gs.showMinimap = !ss.gs.showMinimap
+		}
+		if !ss.lastFrame.IsZero() {
+			ss.gs.elapsed += now.Sub(ss.lastFrame).Seconds()
+		}
+		ss.gs.alpha = min(1, now.Sub(ss.lastState).Seconds()/ss.interval)
+	}
+	ss.lastFrame = now
+	return ss
+}
+
+func (ss *SpectatorScene) apply(msg streamMessage) {
+	switch msg.Type {
+	case "connected":
+		ss.status = "WAITING FOR GAME"
+	case "error":
+		ss.status = "DISCONNECTED"
+		ss.gs = nil
+	case "init":
+		ss.start(msg)
+	case "state":
+		if ss.gs == nil {
+			return
+		}
+		for _, c := range msg.Changes {
+			if c[1] >= 0 && c[1] < len(ss.gs.maze) && c[0] >= 0 && c[0] < len(ss.gs.maze[0]) {
+				ss.gs.setTile(c[0], c[1], c[2])
+			}
+		}
+		ss.setActors(msg, false)
+	case "end":
+		ss.outcome, ss.score = msg.Outcome, msg.Score
+	}
+}
+
+// start は init の盤面で描画用の GameScene を作り直す。
+func (ss *SpectatorScene) start(msg streamMessage) {
+	maze := &Maze{Tiles: parseTileRows(msg.Tiles)}
+	if len(maze.Tiles) == 0 || len(maze.Tiles[0]) == 0 {
+		return
+	}
+	if len(msg.Players) > 0 {
+		maze.PlayerStart = Point{X: int(msg.Players[0][0] / TileSize), Y: int(msg.Players[0][1] / TileSize)}
+	}
+	for _, g := range msg.Ghosts {
+		maze.GhostStarts = append(maze.GhostStarts, Point{X: int(g[0] / TileSize), Y: int(g[1] / TileSize)})
+	}
+	SetScreenSizeForMaze(maze)
+	ss.gs = NewGameScene(maze, GameConfig{Players: max(1, len(msg.Players))})
+	if msg.Level > 0 {
+		ss.gs.SetLevel(msg.Level)
+	}
+	ss.interval = 1 / float64(max(1, msg.Rate))
+	ss.outcome = ""
+	ss.setActors(msg, true)
+}
+
+// setActors は受け取った位置に動かす。snap でなければ前の位置から補間して描く。
+func (ss *SpectatorScene) setActors(msg streamMessage, snap bool) {
+	move := func(a *Actor, x, y, dirX, dirY float64) {
+		a.PrevX, a.PrevY = a.X, a.Y
+		// トンネルでの反対側への移動は補間しない
+		if snap || abs(x-a.X) > 2*TileSize || abs(y-a.Y) > 2*TileSize {
+			a.PrevX, a.PrevY = x, y
+		}
+		a.X, a.Y, a.DirX, a.DirY = x, y, dirX, dirY
+	}
+	for i, p := range msg.Players {
+		if i >= len(ss.gs.players) {
+			break
+		}
+		player := ss.gs.players[i]
+		move(&player.Actor, p[0], p[1], p[2], p[3])
+		player.Chomp, player.Score, player.Lives = p[4], int(p[5]), int(p[6])
+	}
+	for i, g := range msg.Ghosts {
+		if i >= len(ss.gs.ghosts) {
+			break
+		}
+		ghost := ss.gs.ghosts[i]
+		move(&ghost.Actor, g[0], g[1], g[2], g[3])
+		ghost.State, ghost.FrightenedTimer = GhostState(g[4]), g[5]
+	}
+	ss.gs.Score = msg.Score
+	ss.lastState = time.Now()
+}
+
+func (ss *SpectatorScene) Draw(screen *ebiten.Image) {
+	screenWidth, screenHeight := ScreenSize()
+	centerX := float32(screenWidth) / 2
+	centerY := float32(screenHeight) / 2
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	if ss.gs == nil {
+		screen.Fill(color.RGBA{A: 255})
+		drawTextCentered(screen, ss.status, centerX, centerY-5, 2, white)
+		return
+	}
+
+	ss.gs.Draw(screen)
+	drawText(screen, "LIVE", 10, float32(screenHeight)-20, 2, color.RGBA{R: 255, A: 255})
+	if ss.outcome != "" {
+		result := "GAME OVER"
+		if ss.outcome == OutcomeClear {
+			result = "CLEAR!"
+		}
+		vector.DrawFilledRect(screen, 0, centerY-30, float32(screenWidth), 60, color.RGBA{A: 200}, false)
+		drawTextCentered(screen, result, centerX, centerY-20, 4, PlayerColor)
+		drawTextCentered(screen, "NEXT GAME SOON", centerX, centerY+12, 2, white)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	spriteRadius    = float32(TileSize) * 0.4
+	chompSpeed      = 12.0             // 口の開閉の速さ (ラジアン/秒)
+	maxMouthAngle   = math.Pi / 4      // 口を最大に開いたときの片側の角度
+	skirtFrameTime  = 0.15             // スカートの波が切り替わる間隔 (秒)
+	frightenedBlink = 2.0              // イジケ状態の残り時間がこれを切ったら点滅する (秒)
+	blinkInterval   = 0.2              // 点滅の間隔 (秒)
+	skirtWaves      = 3                // スカートの波の数
+	skirtWaveDepth  = spriteRadius / 4 // 波の深さ
+)
+
+var (
+	PlayerColor          = color.RGBA{R: 0xff, G: 0xff, B: 0, A: 0xff}
+	FrightenedGhostColor = color.RGBA{R: 33, G: 33, B: 255, A: 255}
+	FrightenedBlinkColor = color.RGBA{R: 222, G: 222, B: 255, A: 255}
+	FrightenedFaceColor  = color.RGBA{R: 255, G: 184, B: 174, A: 255}
+	EyeWhiteColor        = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	PupilColor           = color.RGBA{R: 33, G: 33, B: 222, A: 255}
+
+	// PlayerColors は同時プレイで n 人目のプレイヤーを描く色
+	PlayerColors = []color.RGBA{PlayerColor, {R: 120, G: 255, B: 120, A: 255}}
+)
+
+// drawPlayer は口を開閉するプレイヤーを描く。口は (dirX, dirY) の方向を向く。
+// chomp は口の開閉アニメーションの経過時間 (秒)。
+func drawPlayer(dst *ebiten.Image, x, y, dirX, dirY, chomp float64, clr color.RGBA) {
+	facing := math.Atan2(dirY, dirX)
+	if dirX == 0 && dirY == 0 {
+		facing = 0
+	}
+	mouth := maxMouthAngle * math.Abs(math.Sin(chomp*chompSpeed))
+
+	cx, cy := float32(x), float32(y)
+	var path vector.Path
+	if mouth < 0.01 {
+		path.Arc(cx, cy, spriteRadius, 0, 2*math.Pi, vector.Clockwise)
+	} else {
+		path.MoveTo(cx, cy)
+		path.Arc(cx, cy, spriteRadius, float32(facing+mouth), float32(facing-mouth+2*math.Pi), vector.Clockwise)
+	}
+	path.Close()
+	fillPath(dst, &path, clr)
+}
+
+// drawGhost はドーム型の頭と波打つスカートを持つゴーストを描く。
+// elapsed はスカートのアニメーションに使う経過時間 (秒)。
+func drawGhost(dst *ebiten.Image, g *Ghost, x, y, elapsed float64) {
+	if g.State == Eaten {
+		// 食べられたゴーストは目だけが巣に戻っていく
+		drawGhostEyes(dst, float32(x), float32(y), g.DirX, g.DirY)
+		return
+	}
+
+	body := g.Color
+	if g.State == Frightened {
+		body = FrightenedGhostColor
+		// 効果が切れる直前は白と青で点滅して知らせる
+		if g.FrightenedTimer < frightenedBlink && int(g.FrightenedTimer/blinkInterval)%2 == 0 {
+			body = FrightenedBlinkColor
+		}
+	}
+
+	cx, cy := float32(x), float32(y)
+	var path vector.Path
+	appendGhostBody(&path, cx, cy, int(elapsed/skirtFrameTime)%2)
+	fillPath(dst, &path, body)
+
+	if g.State == Frightened {
+		drawFrightenedFace(dst, cx, cy)
+		return
+	}
+	drawGhostEyes(dst, cx, cy, g.DirX, g.DirY)
+}
+
+func appendGhostBody(path *vector.Path, cx, cy float32, frame int) {
+	r := spriteRadius
+	domeY := cy - r*0.15
+	bottom := cy + r
+
+	path.MoveTo(cx-r, bottom)
+	path.LineTo(cx-r, domeY)
+	path.Arc(cx, domeY, r, math.Pi, 2*math.Pi, vector.Clockwise)
+	path.LineTo(cx+r, bottom)
+
+	// スカート: 右から左へ半波を並べる。フレームごとに山と谷を入れ替えて揺れているように見せる
+	halfWave := 2 * r / (skirtWaves * 2)
+	x := cx + r
+	for i := 0; i < skirtWaves*2; i++ {
+		depth := skirtWaveDepth
+		if (i+frame)%2 == 1 {
+			depth = -skirtWaveDepth
+		}
+		path.QuadTo(x-halfWave/2, bottom+depth, x-halfWave, bottom)
+		x -= halfWave
+	}
+	path.Close()
+}
+
+// drawGhostEyes は白目と、(dirX, dirY) の方向を向く瞳を描く。
+func drawGhostEyes(dst *ebiten.Image, cx, cy float32, dirX, dirY float64) {
+	r := spriteRadius
+	eyeY := cy - r*0.25
+	lookX := float32(dirX) * r * 0.15
+	lookY := float32(dirY) * r * 0.15
+	for _, side := range []float32{-1, 1} {
+		eyeX := cx + side*r*0.38
+		vector.DrawFilledCircle(dst, eyeX+lookX*0.5, eyeY+lookY*0.5, r*0.3, EyeWhiteColor, true)
+		vector.DrawFilledCircle(dst, eyeX+lookX, eyeY+lookY, r*0.15, PupilColor, true)
+	}
+}
+
+// drawFrightenedFace はイジケ状態のゴーストの小さな目とギザギザの口を描く。
+func drawFrightenedFace(dst *ebiten.Image, cx, cy float32) {
+	r := spriteRadius
+	for _, side := range []float32{-1, 1} {
+		vector.DrawFilledRect(dst, cx+side*r*0.35-r*0.1, cy-r*0.35, r*0.2, r*0.2, FrightenedFaceColor, false)
+	}
+
+	var mouth vector.Path
+	mouthY := cy + r*0.35
+	mouth.MoveTo(cx-r*0.6, mouthY)
+	for i := 1; i <= 6; i++ {
+		dy := r * 0.12
+		if i%2 == 1 {
+			dy = -dy
+		}
+		mouth.LineTo(cx-r*0.6+float32(i)*r*0.2, mouthY+dy)
+	}
+	vertices, indices := mouth.AppendVerticesAndIndicesForStroke(nil, nil, &vector.StrokeOptions{Width: 1.5})
+	drawSolidTriangles(dst, vertices, indices, FrightenedFaceColor)
+}
+
+func fillPath(dst *ebiten.Image, path *vector.Path, clr color.Color) {
+	vertices, indices := path.AppendVerticesAndIndicesForFilling(nil, nil)
+	drawSolidTriangles(dst, vertices, indices, clr)
+}
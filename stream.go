@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 観戦用の配信プロトコル。サーバーから観戦者へ一方的に、1行に1つの JSON を送る。
+//
+//	init   接続直後と新しいゲームの開始時。盤面全体 (tiles) と全員の状態
+//	state  一定間隔で送る。前回から変わったタイル (changes) と全員の状態
+//	end    ゲームの決着。outcome と最終スコア
+//
+// 位置はピクセル単位で小数第2位までに丸める。
+type streamMessage struct {
+	Type    string       `json:"type"`
+	Frame   int          `json:"frame"`
+	Rate    int          `json:"rate,omitempty"`    // init: 1秒あたりの state の数
+	Level   int          `json:"level,omitempty"`   // init
+	Tiles   []string     `json:"tiles,omitempty"`   // init: 1行ごとに、タイルの番号を1文字ずつ並べたもの
+	Changes [][3]int     `json:"changes,omitempty"` // state: 変わったタイルの x, y, 新しいタイル
+	Players [][7]float64 `json:"players,omitempty"` // x, y, dirX, dirY, chomp, score, lives
+	Ghosts  [][6]float64 `json:"ghosts,omitempty"`  // x, y, dirX, dirY, state, frightenedTimer
+	Score   int          `json:"score"`
+	Outcome string       `json:"outcome,omitempty"` // end: OutcomeClear など
+}
+
+// formatTileRows は迷路を1行ずつ、タイルの番号を1文字ずつ並べた文字列にする。タイルの番号は1桁なので1文字に収まる。
+func formatTileRows(maze [][]int) []string {
+	rows := make([]string, len(maze))
+	for y, row := range maze {
+		var line strings.Builder
+		for _, tile := range row {
+			line.WriteString(strconv.Itoa(tile))
+		}
+		rows[y] = line.String()
+	}
+	return rows
+}
+
+// parseTileRows は formatTileRows の逆。
+func parseTileRows(rows []string) [][]int {
+	maze := make([][]int, len(rows))
+	for y, line := range rows {
+		maze[y] = make([]int, len(line))
+		for x, c := range line {
+			maze[y][x] = int(c - '0')
+		}
+	}
+	return maze
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// streamEncoder は GameScene の状態を配信メッセージにする。前回送ったタイルを覚えておき、差分だけを送る。
+type streamEncoder struct {
+	gs    *GameScene
+	frame int
+	rate  int
+	sent  [][]int
+}
+
+func newStreamEncoder(gs *GameScene, rate int) *streamEncoder {
+	e := &streamEncoder{gs: gs, rate: rate}
+	for _, row := range gs.maze {
+		e.sent = append(e.sent, append([]int(nil), row...))
+	}
+	return e
+}
+
+func (e *streamEncoder) actors(msg *streamMessage) {
+	gs := e.gs
+	msg.Frame = e.frame
+	msg.Score = gs.Score
+	for _, p := range gs.players {
+		msg.Players = append(msg.Players, [7]float64{
+			round2(p.X), round2(p.Y), p.DirX, p.DirY, round2(p.Chomp), float64(p.Score), float64(p.Lives),
+		})
+	}
+	for _, g := range gs.ghosts {
+		msg.Ghosts = append(msg.Ghosts, [6]float64{
+			round2(g.X), round2(g.Y), g.DirX, g.DirY, float64(g.State), round2(g.FrightenedTimer),
+		})
+	}
+}
+
+// keyframe は途中から観戦を始めた人にも盤面全体が分かるメッセージを返す。
+func (e *streamEncoder) keyframe() streamMessage {
+	msg := streamMessage{Type: "init", Rate: e.rate, Level: e.gs.level, Tiles: formatTileRows(e.gs.maze)}
+	e.actors(&msg)
+	return msg
+}
+
+// delta は前回の delta から変わったところのメッセージを返す。
+func (e *streamEncoder) delta() streamMessage {
+	msg := streamMessage{Type: "state"}
+	for y, row := range e.gs.maze {
+		for x, tile := range row {
+			if e.sent[y][x] != tile {
+				e.sent[y][x] = tile
+				msg.Changes = append(msg.Changes, [3]int{x, y, tile})
+			}
+		}
+	}
+	e.actors(&msg)
+	return msg
+}
+
+// streamHub は観戦者の接続を持ち、同じメッセージを全員に送る。
+// 送信が追いつかない観戦者は、差分を取りこぼすと盤面が食い違うので切断する。
+// clients は配信のループだけが触る。観戦者ごとの送信のゴルーチンは、書けなくなったら gone で知らせる。
+type streamHub struct {
+	join    chan net.Conn
+	gone    chan net.Conn
+	clients map[net.Conn]chan []byte
+}
+
+const streamClientBuffer = 64
+
+func newStreamHub() *streamHub {
+	return &streamHub{join: make(chan net.Conn), gone: make(chan net.Conn), clients: map[net.Conn]chan []byte{}}
+}
+
+func (h *streamHub) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("serve: %v", err)
+			return
+		}
+		h.join <- conn
+	}
+}
+
+// add は観戦者を加え、最初に keyframe を送る。
+func (h *streamHub) add(conn net.Conn, keyframe streamMessage) {
+	ch := make(chan []byte, streamClientBuffer)
+	h.clients[conn] = ch
+	go func() {
+		for line := range ch {
+			if _, err := conn.Write(line); err != nil {
+				break
+			}
+		}
+		conn.Close()
+		h.gone <- conn
+		// 外されるまでに送られた分は捨てる
+		for range ch {
+		}
+	}()
+	h.sendTo(conn, ch, keyframe)
+	log.Printf("serve: %s is watching (%d spectators)", conn.RemoteAddr(), len(h.clients))
+}
+
+// remove は観戦者を外す。すでに外していれば何もしない。
+func (h *streamHub) remove(conn net.Conn) {
+	ch, ok := h.clients[conn]
+	if !ok {
+		return
+	}
+	delete(h.clients, conn)
+	close(ch)
+	log.Printf("serve: %s left (%d spectators)", conn.RemoteAddr(), len(h.clients))
+}
+
+func (h *streamHub) broadcast(msg streamMessage) {
+	for conn, ch := range h.clients {
+		h.sendTo(conn, ch, msg)
+	}
+}
+
+func (h *streamHub) sendTo(conn net.Conn, ch chan []byte, msg streamMessage) {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("serve: %v", err)
+		return
+	}
+	select {
+	case ch <- append(line, '\n'):
+	default:
+		log.Printf("serve: dropping %s (too slow)", conn.RemoteAddr())
+		h.remove(conn)
+	}
+}
+
+// StreamConfig は配信サーバーの設定。
+type StreamConfig struct {
+	Maze          *Maze
+	Game          GameConfig
+	NewController func(seed int64) Controller // プレイヤーごとのボットを作る
+	Rate          int                         // 1秒あたりの state の数
+	Speed         float64                     // ゲームを実時間の何倍で進めるか
+	Games         int                         // この数だけ遊んだら終わる。0 なら無制限
+	Pause         time.Duration               // 決着から次のゲームまでの間
+}
+
+// ServeStream は listener で観戦者を受け付けながら、ボットのゲームを実時間で進めて配信する。
+func ServeStream(listener net.Listener, config StreamConfig) error {
+	hub := newStreamHub()
+	go hub.accept(listener)
+	rate := config.Game.withDefaults().SimulationRate
+	stepsPerState := max(1, rate/config.Rate)
+
+	for game := 0; config.Games == 0 || game < config.Games; game++ {
+		gameConfig := config.Game
+		gameConfig.Seed += int64(game)
+		gameConfig.Controllers = nil
+		for i := 0; i < max(1, gameConfig.Players); i++ {
+			gameConfig.Controllers = append(gameConfig.Controllers, config.NewController(gameConfig.Seed+int64(i)))
+		}
+		gs := NewGameScene(config.Maze, gameConfig)
+		enc := newStreamEncoder(gs, rate/stepsPerState)
+		hub.broadcast(enc.keyframe())
+
+		dt := gs.clock.Dt()
+		ticker := time.NewTicker(time.Duration(float64(time.Second) * dt / config.Speed))
+		var outcome string
+		for outcome == "" {
+			select {
+			case conn := <-hub.join:
+				hub.add(conn, enc.keyframe())
+				continue
+			case conn := <-hub.gone:
+				hub.remove(conn)
+				continue
+			case <-ticker.C:
+			}
+			switch gs.Step(dt).(type) {
+			case *GameOverScene:
+				outcome = OutcomeDeath
+			case *StageClearScene:
+				outcome = OutcomeClear
+			}
+			enc.frame++
+			if enc.frame%stepsPerState == 0 || outcome != "" {
+				hub.broadcast(enc.delta())
+			}
+		}
+		ticker.Stop()
+		hub.broadcast(streamMessage{Type: "end", Frame: enc.frame, Score: gs.Score, Outcome: outcome})
+		log.Printf("serve: game %d: %s, score %d", game, outcome, gs.Score)
+
+		wait := time.After(config.Pause)
+	pause:
+		for {
+			select {
+			case conn := <-hub.join:
+				hub.add(conn, enc.keyframe())
+			case conn := <-hub.gone:
+				hub.remove(conn)
+			case <-wait:
+				break pause
+			}
+		}
+	}
+	return nil
+}
+
+// runServe は serve コマンド。画面を出さずにボットのゲームを続けて進め、TCP で観戦者に配信する。
+// 観戦は `PackManClaude -watch <address>` で行う。
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("listen", ":7778", "address to accept spectators on")
+	mazePath := fs.String("maze", "", "maze file (default: built-in maze)")
+	bot := fs.String("bot", "autopilot", "player: autopilot, random, greedy, or a script file")
+	players := fs.Int("players", 1, "number of bot players in the same maze")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "seed of the first game; game i uses seed+i")
+	games := fs.Int("games", 0, "stop after this many games (0: forever)")
+	rate := fs.Int("rate", 30, "state messages per second")
+	speed := fs.Float64("speed", 1, "game speed relative to real time")
+	pause := fs.Duration("pause", 3*time.Second, "pause between games")
+	fs.Parse(args)
+
+	if *rate < 1 || *speed <= 0 || *players < 1 {
+		return fmt.Errorf("-rate, -speed and -players must be positive")
+	}
+	maze := DefaultMaze()
+	if *mazePath != "" {
+		var err error
+		if maze, err = LoadMaze(*mazePath); err != nil {
+			return err
+		}
+	}
+	newController, err := controllerFactory(*bot)
+	if err != nil {
+		return err
+	}
+	SetScreenSizeForMaze(maze)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	log.Printf("serve: streaming on %s", listener.Addr())
+	return ServeStream(listener, StreamConfig{
+		Maze:          maze,
+		Game:          GameConfig{Seed: *seed, Players: *players},
+		NewController: newController,
+		Rate:          *rate,
+		Speed:         *speed,
+		Games:         *games,
+		Pause:         *pause,
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTileRowsRoundTrip(t *testing.T) {
+	maze := loadArcadeMaze(t).Tiles
+	rows := formatTileRows(maze)
+	if len(rows) != len(maze) || len(rows[0]) != len(maze[0]) {
+		t.Fatalf("formatted %d rows of %d, want %d of %d", len(rows), len(rows[0]), len(maze), len(maze[0]))
+	}
+	if got := parseTileRows(rows); !reflect.DeepEqual(got, maze) {
+		t.Errorf("parseTileRows(formatTileRows(maze)) differs from maze:\n%v", formatTileRows(got))
+	}
+}
+
+// wireMessage は観戦者と同じように、JSON にして読み戻したメッセージを返す。
+func wireMessage(t *testing.T, msg streamMessage) streamMessage {
+	t.Helper()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got streamMessage
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// keyframe の盤面に delta の変更を当てると、今の盤面になる。
+func TestKeyframeThenDeltaRebuildsMaze(t *testing.T) {
+	gs := NewGameScene(DefaultMaze(), GameConfig{Seed: 1, Controllers: []Controller{&GreedyController{}}})
+	enc := newStreamEncoder(gs, DefaultSimulationRate)
+	key := wireMessage(t, enc.keyframe())
+	if key.Type != "init" {
+		t.Fatalf("keyframe type = %q, want init", key.Type)
+	}
+	tiles := parseTileRows(key.Tiles)
+
+	dt := gs.clock.Dt()
+	for i := 0; i < 2*DefaultSimulationRate; i++ {
+		gs.Step(dt)
+	}
+	delta := wireMessage(t, enc.delta())
+	if len(delta.Changes) == 0 {
+		t.Fatal("no tile changes after two seconds of eating dots")
+	}
+	for _, c := range delta.Changes {
+		tiles[c[1]][c[0]] = c[2]
+	}
+	if !reflect.DeepEqual(tiles, gs.maze) {
+		t.Errorf("keyframe plus delta:\n%v\nwant:\n%v", formatTileRows(tiles), formatTileRows(gs.maze))
+	}
+	p := gs.players[0]
+	if got := delta.Players[0]; got[0] != round2(p.X) || got[1] != round2(p.Y) || int(got[5]) != p.Score {
+		t.Errorf("player in delta = %v, want position %.2f,%.2f and score %d", got, p.X, p.Y, p.Score)
+	}
+
+	if again := enc.delta(); len(again.Changes) != 0 {
+		t.Errorf("second delta without steps has changes %v", again.Changes)
+	}
+}
+
+// 相手が切った観戦者は、送信のゴルーチンが知らせてハブから外れる。
+// net.Pipe は閉じた相手への書き込みがすぐ失敗するので、切断をすぐ起こせる。
+func TestStreamHubRemovesClosedClient(t *testing.T) {
+	hub := newStreamHub()
+	server, client := net.Pipe()
+	client.Close()
+	hub.add(server, streamMessage{Type: "init"})
+	select {
+	case conn := <-hub.gone:
+		hub.remove(conn)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hub was not told that the spectator left")
+	}
+	if len(hub.clients) != 0 {
+		t.Errorf("%d spectators left in the hub, want 0", len(hub.clients))
+	}
+}
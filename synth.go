@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const SampleRate = 44100
+
+type Waveform int
+
+const (
+	WaveSquare Waveform = iota
+	WaveTriangle
+	WaveNoise
+)
+
+// Envelope は ADSR エンベロープ。Attack/Decay/Release は秒、Sustain は 0〜1 の音量。
+type Envelope struct {
+	Attack  float64
+	Decay   float64
+	Sustain float64
+	Release float64
+}
+
+// Note は1つの音。FreqEnd を指定すると Duration の間に Freq から FreqEnd へ滑らかに変化する。
+// Freq が 0 の場合は休符。
+type Note struct {
+	Wave     Waveform
+	Freq     float64
+	FreqEnd  float64
+	Duration float64
+	Volume   float64
+	Duty     float64 // 矩形波のデューティ比 (0 の場合は 0.5)
+	Env      Envelope
+}
+
+// Synth は波形をコードで生成する。出力はモノラルの float32 サンプル (-1〜1)。
+// 同じ入力からは常に同じサンプル列を返すので、ヘッドレスでもバッファの中身を検証できる。
+type Synth struct {
+	SampleRate int
+	noise      uint16
+}
+
+func NewSynth(sampleRate int) *Synth {
+	return &Synth{SampleRate: sampleRate, noise: 1}
+}
+
+// Render は音符を順に並べて1本のサンプル列にする。
+func (s *Synth) Render(notes []Note) []float32 {
+	var samples []float32
+	for _, note := range notes {
+		samples = s.appendNote(samples, note)
+	}
+	return samples
+}
+
+func (s *Synth) appendNote(samples []float32, note Note) []float32 {
+	count := int(note.Duration * float64(s.SampleRate))
+	duty := note.Duty
+	if duty == 0 {
+		duty = 0.5
+	}
+	freqEnd := note.FreqEnd
+	if freqEnd == 0 {
+		freqEnd = note.Freq
+	}
+
+	phase := 0.0
+	noiseValue := float32(1)
+	for i := 0; i < count; i++ {
+		if note.Freq == 0 {
+			samples = append(samples, 0)
+			continue
+		}
+
+		t := float64(i) / float64(s.SampleRate)
+		progress := float64(i) / float64(count)
+		freq := note.Freq + (freqEnd-note.Freq)*progress
+
+		var value float32
+		switch note.Wave {
+		case WaveSquare:
+			if phase < duty {
+				value = 1
+			} else {
+				value = -1
+			}
+		case WaveTriangle:
+			value = float32(4*math.Abs(phase-0.5) - 1)
+		case WaveNoise:
+			// 周波数ごとに LFSR を進める (ファミコンのノイズチャンネルと同じ方式)
+			if phase+freq/float64(s.SampleRate) >= 1 {
+				noiseValue = s.nextNoise()
+			}
+			value = noiseValue
+		}
+
+		amplitude := note.Volume * note.Env.amplitude(t, note.Duration)
+		samples = append(samples, value*float32(amplitude))
+
+		phase += freq / float64(s.SampleRate)
+		phase -= math.Floor(phase)
+	}
+	return samples
+}
+
+func (s *Synth) nextNoise() float32 {
+	bit := (s.noise ^ (s.noise >> 1)) & 1
+	s.noise = (s.noise >> 1) | (bit << 14)
+	if s.noise&1 == 1 {
+		return 1
+	}
+	return -1
+}
+
+// amplitude は音の開始から t 秒後のエンベロープの音量を返す。
+func (e Envelope) amplitude(t, duration float64) float64 {
+	if e == (Envelope{}) {
+		return 1
+	}
+
+	level := e.Sustain
+	switch {
+	case e.Attack > 0 && t < e.Attack:
+		level = t / e.Attack
+	case e.Decay > 0 && t < e.Attack+e.Decay:
+		level = 1 - (1-e.Sustain)*(t-e.Attack)/e.Decay
+	}
+
+	releaseStart := duration - e.Release
+	if e.Release > 0 && t > releaseStart {
+		level *= math.Max(0, 1-(t-releaseStart)/e.Release)
+	}
+	return level
+}
+
+// Mix は複数のトラックを足し合わせる。長さは一番長いトラックに揃える。
+func Mix(tracks ...[]float32) []float32 {
+	length := 0
+	for _, track := range tracks {
+		if len(track) > length {
+			length = len(track)
+		}
+	}
+	mixed := make([]float32, length)
+	for _, track := range tracks {
+		for i, v := range track {
+			mixed[i] += v
+		}
+	}
+	for i, v := range mixed {
+		mixed[i] = float32(math.Max(-1, math.Min(1, float64(v))))
+	}
+	return mixed
+}
+
+// StereoF32Bytes はモノラルのサンプル列を、ebiten/audio の F32 プレイヤー用のステレオのバイト列に変換する。
+func StereoF32Bytes(samples []float32) []byte {
+	buf := make([]byte, len(samples)*8)
+	for i, v := range samples {
+		bits := math.Float32bits(v)
+		binary.LittleEndian.PutUint32(buf[i*8:], bits)
+		binary.LittleEndian.PutUint32(buf[i*8+4:], bits)
+	}
+	return buf
+}
+
+// noteFreq は MIDI ノート番号を周波数に変換する (69 = A4 = 440Hz)。
+func noteFreq(midi int) float64 {
+	return 440 * math.Pow(2, float64(midi-69)/12)
+}
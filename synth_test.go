@@ -0,0 +1,163 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRenderLength(t *testing.T) {
+	tests := []struct {
+		sampleRate int
+		notes      []Note
+		want       int
+	}{
+		{SampleRate, []Note{{Wave: WaveSquare, Freq: 440, Duration: 0.25, Volume: 1}}, 11025},
+		{8000, []Note{{Wave: WaveTriangle, Freq: 440, Duration: 0.5, Volume: 1}}, 4000},
+		// 休符も長さの分だけ無音のサンプルになる
+		{8000, []Note{{Freq: 440, Duration: 0.1, Volume: 1}, {Duration: 0.2}, {Wave: WaveNoise, Freq: 1000, Duration: 0.3, Volume: 1}}, 4800},
+	}
+	for _, tt := range tests {
+		got := NewSynth(tt.sampleRate).Render(tt.notes)
+		if len(got) != tt.want {
+			t.Errorf("Render at %dHz = %d samples, want %d", tt.sampleRate, len(got), tt.want)
+		}
+	}
+}
+
+func TestEnvelopeLevels(t *testing.T) {
+	env := Envelope{Attack: 0.1, Decay: 0.1, Sustain: 0.5, Release: 0.2}
+	const duration = 1.0
+	tests := []struct {
+		t, want float64
+	}{
+		{0, 0},
+		{0.05, 0.5},  // attack の途中
+		{0.1, 1},     // attack の終わり
+		{0.15, 0.75}, // decay の途中
+		{0.5, 0.5},   // sustain
+		{0.9, 0.25},  // release の途中
+		{1.0, 0},     // release の終わり
+	}
+	for _, tt := range tests {
+		if got := env.amplitude(tt.t, duration); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("amplitude(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+	if got := (Envelope{}).amplitude(0.5, duration); got != 1 {
+		t.Errorf("empty envelope amplitude = %v, want 1", got)
+	}
+
+	// 矩形波なのでサンプルの大きさがそのままエンベロープの音量になる
+	const rate = 1000
+	samples := NewSynth(rate).Render([]Note{{Wave: WaveSquare, Freq: 125, Duration: duration, Volume: 0.8, Env: env}})
+	for _, tt := range tests[:len(tests)-1] {
+		i := int(tt.t * rate)
+		if got := math.Abs(float64(samples[i])); math.Abs(got-0.8*tt.want) > 1e-6 {
+			t.Errorf("sample at %vs = %v, want %v", tt.t, got, 0.8*tt.want)
+		}
+	}
+}
+
+func TestSquareWavePeriod(t *testing.T) {
+	// 1サンプルあたりの位相が 1/64 ちょうどになるので、丸め誤差なしに 64 サンプル周期になる
+	const rate, freq, period = 8000, 125, 64
+	const periods = 64
+	for _, duty := range []float64{0.5, 0.25} {
+		samples := NewSynth(rate).Render([]Note{{Wave: WaveSquare, Freq: freq, Duration: float64(period*periods) / rate, Volume: 1, Duty: duty}})
+		if len(samples) != period*periods {
+			t.Fatalf("duty %v: %d samples, want %d", duty, len(samples), period*periods)
+		}
+		for i := period; i < len(samples); i++ {
+			if samples[i] != samples[i-period] {
+				t.Fatalf("duty %v: sample %d = %v, but one period earlier = %v", duty, i, samples[i], samples[i-period])
+			}
+		}
+		high := 0
+		for _, v := range samples[:period] {
+			if v > 0 {
+				high++
+			}
+		}
+		if want := int(duty * period); high != want {
+			t.Errorf("duty %v: %d high samples per period, want %d", duty, high, want)
+		}
+		// 1周期に上がりと下がりが1回ずつ。最後の周期の終わりの上がりは含まない
+		crossings := 0
+		for i := 1; i < len(samples); i++ {
+			if (samples[i] > 0) != (samples[i-1] > 0) {
+				crossings++
+			}
+		}
+		if want := 2*periods - 1; crossings != want {
+			t.Errorf("duty %v: %d zero crossings, want %d", duty, crossings, want)
+		}
+	}
+}
+
+func TestSilence(t *testing.T) {
+	notes := []Note{
+		{Wave: WaveSquare, Freq: 440, Duration: 0.1, Volume: 0},
+		{Wave: WaveNoise, Freq: 1000, Duration: 0.1, Volume: 0},
+		{Wave: WaveTriangle, Duration: 0.1, Volume: 1}, // 休符
+	}
+	for i, v := range NewSynth(8000).Render(notes) {
+		if v != 0 {
+			t.Fatalf("sample %d = %v, want silence", i, v)
+		}
+	}
+
+	sm := &SoundManager{volume: 0.5, muted: true}
+	if v := sm.effectiveVolume(); v != 0 {
+		t.Errorf("muted volume = %v, want 0", v)
+	}
+	sm.ToggleMute()
+	if v := sm.effectiveVolume(); v != 0.5 {
+		t.Errorf("unmuted volume = %v, want 0.5", v)
+	}
+	sm.SetVolume(-1)
+	if v := sm.effectiveVolume(); v != 0 {
+		t.Errorf("volume after SetVolume(-1) = %v, want 0", v)
+	}
+
+	// 音のない実行では SoundManager は nil のまま使う
+	var none *SoundManager
+	none.Play(SoundDeath)
+	if none.Volume() != 0 || none.Muted() || none.IsPlaying(SoundDeath) {
+		t.Error("nil SoundManager is not silent")
+	}
+}
+
+func TestNoiseIsDeterministic(t *testing.T) {
+	note := Note{Wave: WaveNoise, Freq: 2000, Duration: 0.2, Volume: 0.5}
+	a := NewSynth(8000).Render([]Note{note})
+	b := NewSynth(8000).Render([]Note{note})
+	positive, negative := 0, 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("sample %d differs: %v != %v", i, a[i], b[i])
+		}
+		switch a[i] {
+		case 0.5:
+			positive++
+		case -0.5:
+			negative++
+		default:
+			t.Fatalf("sample %d = %v, want ±0.5", i, a[i])
+		}
+	}
+	if positive == 0 || negative == 0 {
+		t.Errorf("noise is constant: %d positive, %d negative samples", positive, negative)
+	}
+
+	for _, id := range AllSounds {
+		first, second := GenerateSound(id), GenerateSound(id)
+		if len(first) != len(second) {
+			t.Fatalf("sound %d: length %d != %d", id, len(first), len(second))
+		}
+		for i := range first {
+			if first[i] != second[i] {
+				t.Fatalf("sound %d: sample %d differs", id, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TelemetrySampleInterval は位置を記録する間隔 (シミュレーション上の秒)。
+const TelemetrySampleInterval = 0.1
+
+// OutcomeQuit は決着の前にゲームを抜けたときの outcome。
+const OutcomeQuit = "quit"
+
+// telemetryRecord は記録の1行。t はゲーム開始からの秒数 (シミュレーション上の時刻)。
+//
+//	start  ゲームの開始。実時刻 (time)、シード、迷路 (tiles)、位置の記録間隔 (sample)
+//	pos    sample 秒ごとの全員の位置
+//	<出来事> EventBus に発行された出来事 (dot_eaten など)。event にその中身、players と ghosts にその時の位置
+//	end    ゲームの終わり。outcome と最終スコア
+type telemetryRecord struct {
+	Type    string          `json:"type"`
+	T       float64         `json:"t"`
+	Time    string          `json:"time,omitempty"`
+	Seed    int64           `json:"seed,omitempty"`
+	Level   int             `json:"level,omitempty"`
+	Sample  float64         `json:"sample,omitempty"`
+	Tiles   []string        `json:"tiles,omitempty"`
+	Event   json.RawMessage `json:"event,omitempty"`
+	Players [][2]float64    `json:"players,omitempty"` // x, y (ピクセル)
+	Dead    []int           `json:"dead,omitempty"`    // 残機がなくなったプレイヤーの添字。位置は最後にいた場所のまま
+	Ghosts  [][2]float64    `json:"ghosts,omitempty"`
+	Score   int             `json:"score,omitempty"`
+	Outcome string          `json:"outcome,omitempty"`
+}
+
+// TelemetryLog はゲーム1回分の記録を JSON Lines で書き出す。出来事は EventBus から受け取る。
+// 1行ずつファイルに書くので、途中で落ちてもそこまでの記録は残る。
+type TelemetryLog struct {
+	gs         *GameScene
+	file       *os.File
+	enc        *json.Encoder
+	nextSample float64
+	// continues は GameOver の後も同じゲームを続けるとき (交代制) に立てる。GameOver では閉じず、End で閉じる
+	continues bool
+	// replaying はデバッガで巻き戻して、記録済みのフレームを進め直している間に立てる。同じ出来事を二重に書かない
+	replaying bool
+}
+
+// NewTelemetryLog は dir に新しい記録のファイルを作って gs の出来事を書き始める。
+func NewTelemetryLog(dir string, gs *GameScene, seed int64) (*TelemetryLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-seed%d.jsonl", now.Format("20060102-150405.000"), seed)
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	t := &TelemetryLog{gs: gs, file: file, enc: json.NewEncoder(file)}
+	t.write(telemetryRecord{
+		Type:   "start",
+		Time:   now.Format(time.RFC3339Nano),
+		Seed:   seed,
+		Level:  gs.level,
+		Sample: TelemetrySampleInterval,
+		Tiles:  formatTileRows(gs.maze),
+	})
+	gs.events.Subscribe(t.record)
+	return t, nil
+}
+
+func (t *TelemetryLog) write(r telemetryRecord) {
+	if t.file == nil {
+		return
+	}
+	r.T = round2(t.gs.elapsed)
+	if err := t.enc.Encode(r); err != nil {
+		log.Printf("telemetry: %v", err)
+		t.Close()
+	}
+}
+
+// positions は全員の今の位置を r に書き込む。出来事の添字で引けるよう、脱落したプレイヤーも並びに残して Dead に記す。
+func (t *TelemetryLog) positions(r *telemetryRecord) {
+	for i, player := range t.gs.players {
+		r.Players = append(r.Players, [2]float64{round2(player.X), round2(player.Y)})
+		if !player.Alive() {
+			r.Dead = append(r.Dead, i)
+		}
+	}
+	for _, ghost := range t.gs.ghosts {
+		r.Ghosts = append(r.Ghosts, [2]float64{round2(ghost.X), round2(ghost.Y)})
+	}
+}
+
+// Sample はステップごとに呼び、TelemetrySampleInterval ごとに位置を記録する。
+func (t *TelemetryLog) Sample() {
+	if t == nil || t.gs.elapsed < t.nextSample {
+		return
+	}
+	t.nextSample += TelemetrySampleInterval
+	r := telemetryRecord{Type: "pos"}
+	t.positions(&r)
+	t.write(r)
+}
+
+// SetReplaying は記録済みのフレームを進め直しているかどうかを設定する。進め直している間の出来事は書かない。
+func (t *TelemetryLog) SetReplaying(replaying bool) {
+	if t != nil {
+		t.replaying = replaying
+	}
+}
+
+// record は出来事を記録する。決着の出来事では end を書いて閉じる。
+func (t *TelemetryLog) record(e Event) {
+	if t.replaying {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("telemetry: %v", err)
+		return
+	}
+	r := telemetryRecord{Type: e.EventName(), Event: data}
+	t.positions(&r)
+	t.write(r)
+
+	switch e.(type) {
+	case GameOver:
+		if !t.continues {
+			t.End(OutcomeDeath)
+		}
+	case LevelCleared:
+		t.End(OutcomeClear)
+	}
+}
+
+// End は end を書いて閉じる。閉じた後は何もしない。
+func (t *TelemetryLog) End(outcome string) {
+	if t == nil || t.file == nil {
+		return
+	}
+	t.write(telemetryRecord{Type: "end", Score: t.gs.Score, Outcome: outcome})
+	t.Close()
+}
+
+// Abort は決着の前にゲームをやめたときに呼ぶ。
+func (t *TelemetryLog) Abort(outcome string) {
+	t.End(outcome)
+}
+
+func (t *TelemetryLog) Close() {
+	if t == nil || t.file == nil {
+		return
+	}
+	if err := t.file.Close(); err != nil {
+		log.Printf("telemetry: %v", err)
+	}
+	t.file = nil
+}
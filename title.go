@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image/color"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+type menuItem struct {
+	label  string
+	action func(app *App) Scene
+}
+
+var titleMenu = []menuItem{
+	{label: "PLAY", action: func(app *App) Scene { return app.NewGame(app.Maze) }},
+	{label: "2 PLAYERS", action: func(app *App) Scene { return app.NewTwoPlayerGame() }},
+	{label: "CO-OP", action: func(app *App) Scene { return app.NewCoopGame() }},
+	{label: "VERSUS", action: func(app *App) Scene { return app.NewVersusGame() }},
+	{label: "ONLINE", action: func(app *App) Scene { return NewNetMenuScene(app) }},
+	{label: "RANDOM MAZE", action: func(app *App) Scene { return app.NewRandomGame() }},
+	{label: "EDITOR", action: func(app *App) Scene { return app.Editor() }},
+}
+
+// TitleScene はタイトル画面。上下キーでモードを選び、Enter で開始する。
+type TitleScene struct {
+	app       *App
+	selected  int
+	idleSince time.Time
+}
+
+// 何も操作されないままこの時間が経つとデモを始める
+const attractDelay = 10 * time.Second
+
+func (ts *TitleScene) Update() Scene {
+	if ts.idleSince.IsZero() || len(inpututil.AppendPressedKeys(nil)) > 0 {
+		ts.idleSince = time.Now()
+	}
+	if time.Since(ts.idleSince) > attractDelay {
+		return ts.app.Demo()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyArrowUp) {
+		ts.selected = (ts.selected + len(titleMenu) - 1) % len(titleMenu)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyArrowDown) {
+		ts.selected = (ts.selected + 1) % len(titleMenu)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		return titleMenu[ts.selected].action(ts.app)
+	}
+	return ts
+}
+
+func (ts *TitleScene) Draw(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{R: 0, G: 0, B: 0, A: 255})
+	screenWidth, screenHeight := ScreenSize()
+	centerX := float32(screenWidth) / 2
+	top := float32(screenHeight)/2 - 70
+
+	drawTextCentered(screen, "PACKMAN", centerX, top, 5, PlayerColor)
+	for i, item := range titleMenu {
+		clr := color.RGBA{R: 160, G: 160, B: 160, A: 255}
+		label := item.label
+		if i == ts.selected {
+			clr = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			label = "> " + label
+		}
+		drawTextCentered(screen, label, centerX, top+60+float32(i)*24, 3, clr)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // 遊べるが意図していない可能性が高い
+	SeverityError                   // クリアできない・ゲームが成り立たない
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Issue は迷路の問題点ひとつ。X, Y は問題のあるタイルの座標。
+type Issue struct {
+	Severity Severity `json:"severity"`
+	X        int      `json:"x"`
+	Y        int      `json:"y"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s at (%d,%d): %s", i.Severity, i.X, i.Y, i.Message)
+}
+
+type MazeStats struct {
+	Width           int `json:"width"`
+	Height          int `json:"height"`
+	Dots            int `json:"dots"`
+	Pellets         int `json:"pellets"`
+	Intersections   int `json:"intersections"` // 3方向以上に分岐する通路のタイル
+	DeadEnds        int `json:"deadEnds"`
+	LongestCorridor int `json:"longestCorridor"` // 縦または横にまっすぐ続く通路の最長タイル数
+	Regions         int `json:"regions"`         // つながった通路のまとまりの数 (扉は通れるものとする)
+}
+
+type ValidationReport struct {
+	Issues []Issue   `json:"issues"`
+	Stats  MazeStats `json:"stats"`
+}
+
+func (r *ValidationReport) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ValidationReport) add(severity Severity, p Point, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Severity: severity, X: p.X, Y: p.Y, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateMaze は迷路を検査して、見つかった問題と統計をまとめて返す。
+// ドットの到達可能性はプレイヤー (扉を通れない) の移動で、
+// 領域や行き止まりの判定は扉と一方通行を区別しない通路のつながりで調べる。
+func ValidateMaze(m *Maze) *ValidationReport {
+	report := &ValidationReport{}
+	report.Stats.Width = m.Width()
+	report.Stats.Height = m.Height()
+
+	playerPaths := NewPathfinder(m.Tiles, false)
+	ghostPaths := NewPathfinder(m.Tiles, true)
+
+	playerOK := validateSpawn(report, playerPaths, m.PlayerStart, "player start")
+	if len(m.GhostStarts) == 0 {
+		report.add(SeverityWarning, Point{}, "maze has no ghost start (G)")
+	}
+	for _, g := range m.GhostStarts {
+		if validateSpawn(report, ghostPaths, g, "ghost start") && playerOK && ghostPaths.Distance(g, m.PlayerStart) < 0 {
+			report.add(SeverityError, g, "ghost cannot reach the player start")
+		}
+	}
+
+	var reachable []int32
+	if playerOK {
+		reachable = playerPaths.DistanceField(m.PlayerStart)
+	}
+	for y, row := range m.Tiles {
+		for x, tile := range row {
+			p := Point{X: x, Y: y}
+			switch tile {
+			case TileDot:
+				report.Stats.Dots++
+			case TilePellet:
+				report.Stats.Pellets++
+			default:
+				continue
+			}
+			if playerOK && reachable[y*m.Width()+x] < 0 {
+				report.add(SeverityError, p, "%s is unreachable from the player start", tileName(tile))
+			}
+		}
+	}
+	if report.Stats.Dots+report.Stats.Pellets == 0 {
+		report.add(SeverityError, Point{}, "maze has no dots, so the stage can never be cleared")
+	}
+
+	validateTopology(report, m, ghostPaths)
+	return report
+}
+
+// validateSpawn は初期位置が迷路の中の通れるタイルにあるかを調べる。
+func validateSpawn(report *ValidationReport, pf *Pathfinder, p Point, what string) bool {
+	if !pf.InBounds(p) {
+		report.add(SeverityError, p, "%s is outside the maze", what)
+		return false
+	}
+	if !pf.Walkable(p) {
+		report.add(SeverityError, p, "%s is inside a %s", what, tileName(pf.maze[p.Y][p.X]))
+		return false
+	}
+	return true
+}
+
+// validateTopology は通路のつながりを調べ、分断された領域・行き止まり・外へ抜けられる端を報告する。
+func validateTopology(report *ValidationReport, m *Maze, pf *Pathfinder) {
+	width, height := m.Width(), m.Height()
+	region := make([]int, width*height)
+	for i := range region {
+		region[i] = -1
+	}
+
+	playerRegion := -1
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := Point{X: x, Y: y}
+			if !pf.Walkable(p) {
+				continue
+			}
+			neighbors := openNeighbors(pf, p)
+			switch {
+			case len(neighbors) == 1:
+				report.Stats.DeadEnds++
+				report.add(SeverityWarning, p, "dead end")
+			case len(neighbors) >= 3:
+				report.Stats.Intersections++
+			}
+			if (x == 0 || y == 0 || x == width-1 || y == height-1) && m.Tiles[y][x] != TileTunnel {
+				report.add(SeverityWarning, p, "open tile on the maze edge is not a tunnel")
+			}
+
+			if region[y*width+x] >= 0 {
+				continue
+			}
+			id := report.Stats.Regions
+			report.Stats.Regions++
+			size, dots := floodRegion(pf, m, p, id, region)
+			if pf.InBounds(m.PlayerStart) && region[m.PlayerStart.Y*width+m.PlayerStart.X] == id {
+				playerRegion = id
+			}
+			if playerRegion != id {
+				report.add(SeverityWarning, p, "region of %d tiles (%d dots) is disconnected from the player start", size, dots)
+			}
+		}
+	}
+
+	report.Stats.LongestCorridor = longestCorridor(pf, width, height)
+}
+
+// openNeighbors は p から上下左右に進める通路のタイルを返す。一方通行の向きは無視する。
+func openNeighbors(pf *Pathfinder, p Point) []Point {
+	var neighbors []Point
+	for _, dir := range Directions {
+		next := p.Add(dir)
+		if !pf.InBounds(next) {
+			if pf.maze[p.Y][p.X] != TileTunnel {
+				continue
+			}
+			next.X = (next.X + pf.width) % pf.width
+			next.Y = (next.Y + pf.height) % pf.height
+		}
+		if pf.Walkable(next) {
+			neighbors = append(neighbors, next)
+		}
+	}
+	return neighbors
+}
+
+// floodRegion は start からつながる通路に id を付け、タイル数とドット数を返す。
+func floodRegion(pf *Pathfinder, m *Maze, start Point, id int, region []int) (int, int) {
+	width := m.Width()
+	region[start.Y*width+start.X] = id
+	queue := []Point{start}
+	size, dots := 0, 0
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		size++
+		if tile := m.Tiles[p.Y][p.X]; tile == TileDot || tile == TilePellet {
+			dots++
+		}
+		for _, next := range openNeighbors(pf, p) {
+			if region[next.Y*width+next.X] < 0 {
+				region[next.Y*width+next.X] = id
+				queue = append(queue, next)
+			}
+		}
+	}
+	return size, dots
+}
+
+func longestCorridor(pf *Pathfinder, width, height int) int {
+	longest := 0
+	run := func(walkable bool, n int) int {
+		if walkable {
+			n++
+			longest = max(longest, n)
+			return n
+		}
+		return 0
+	}
+	for y := 0; y < height; y++ {
+		n := 0
+		for x := 0; x < width; x++ {
+			n = run(pf.Walkable(Point{X: x, Y: y}), n)
+		}
+	}
+	for x := 0; x < width; x++ {
+		n := 0
+		for y := 0; y < height; y++ {
+			n = run(pf.Walkable(Point{X: x, Y: y}), n)
+		}
+	}
+	return longest
+}
+
+func tileName(tile int) string {
+	switch tile {
+	case TileEmpty:
+		return "empty tile"
+	case TileWall:
+		return "wall"
+	case TileDot:
+		return "dot"
+	case TilePellet:
+		return "power pellet"
+	case TileDoor:
+		return "door"
+	case TileTunnel:
+		return "tunnel"
+	}
+	return "one-way tile"
+}
+
+// runValidate は validate コマンド。迷路ファイルを検査し、エラーがあれば失敗を返す。
+// -strict を付けると警告も失敗として扱う。
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	strict := fs.Bool("strict", false, "treat warnings as failures")
+	asJSON := fs.Bool("json", false, "print reports as JSON")
+	quiet := fs.Bool("q", false, "print only failing mazes")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: validate [-strict] [-json] [-q] maze.txt...")
+	}
+
+	failed := 0
+	reports := map[string]*ValidationReport{}
+	for _, path := range fs.Args() {
+		m, err := LoadMaze(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		report := ValidateMaze(m)
+		fails := report.HasErrors() || (*strict && len(report.Issues) > 0)
+		if fails {
+			failed++
+		}
+		if *asJSON {
+			reports[path] = report
+			continue
+		}
+		if *quiet && !fails {
+			continue
+		}
+		for _, issue := range report.Issues {
+			fmt.Printf("%s: %s\n", path, issue)
+		}
+		s := report.Stats
+		fmt.Printf("%s: %dx%d, %d dots, %d pellets, %d intersections, %d dead ends, longest corridor %d, %d regions\n",
+			path, s.Width, s.Height, s.Dots, s.Pellets, s.Intersections, s.DeadEnds, s.LongestCorridor, s.Regions)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d mazes failed validation", failed, fs.NArg())
+	}
+	return nil
+}
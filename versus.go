@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	VersusRounds      = 4    // 役割を交代しながら遊ぶラウンド数。偶数なら2人とも同じ回数ずつ両方の役をやる
+	VersusCatchPoints = 1000 // ゴースト役がプレイヤーを1回捕まえたときの点
+)
+
+// VersusScene は対戦モード。1人がプレイヤー (パックマン) を、もう1人が1匹目のゴーストを操作し、
+// 残りのゴーストは AI が動かす。プレイヤー役はドットなどの点を、ゴースト役は捕まえた回数に応じた点を得る。
+// ラウンドごとに役を入れ替え、合計点で勝敗を決める。
+// 1UP は矢印キーと1台目のゲームパッド、2UP は WASD と2台目のゲームパッドを、役に関係なく使う。
+type VersusScene struct {
+	maze        *Maze
+	config      GameConfig
+	controllers [2]KeyboardController
+	scores      [2]int // 終わったラウンドまでの合計点
+	round       int
+	game        *GameScene
+	readyUntil  time.Time // この時刻までラウンドの表示を出してゲームを止める
+	paused      bool
+	finished    bool
+	exit        func() Scene
+}
+
+func NewVersusScene(maze *Maze, config GameConfig, exit func() Scene) *VersusScene {
+	vs := &VersusScene{
+		maze:   maze,
+		config: config,
+		controllers: [2]KeyboardController{
+			NewKeyboardController(ArrowKeys, 1),
+			NewKeyboardController(WASDKeys, 2),
+		},
+		exit: exit,
+	}
+	vs.startRound()
+	return vs
+}
+
+// pac はこのラウンドでプレイヤー役をする人 (0 か 1) を返す。もう1人がゴースト役。
+func (vs *VersusScene) pac() int {
+	return vs.round % 2
+}
+
+func (vs *VersusScene) startRound() {
+	config := vs.config
+	config.Seed += int64(vs.round)
+	config.Players = 1
+	config.Lives = StartingLives
+	config.Controllers = []Controller{vs.controllers[vs.pac()]}
+	config.GhostControllers = []GhostController{vs.controllers[1-vs.pac()]}
+	gs := NewGameScene(vs.maze, config)
+	gs.exit = vs.exit
+	gs.hud = vs.drawHUD
+	vs.game = gs
+	vs.readyUntil = time.Now().Add(readyDuration)
+	vs.paused = true
+}
+
+// roundScores はいま遊んでいるラウンドでそれぞれが得た点を返す。
+func (vs *VersusScene) roundScores() [2]int {
+	var scores [2]int
+	scores[vs.pac()] = vs.game.players[0].Score
+	for _, ghost := range vs.game.ghosts {
+		if ghost.Controller != nil {
+			scores[1-vs.pac()] += ghost.Catches * VersusCatchPoints
+		}
+	}
+	return scores
+}
+
+func (vs *VersusScene) Update() Scene {
+	if vs.finished {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) && !ebiten.IsKeyPressed(ebiten.KeyAlt) && vs.exit != nil {
+			return vs.exit()
+		}
+		return vs
+	}
+	if time.Now().Before(vs.readyUntil) {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEscape) && vs.exit != nil {
+			vs.game.telemetry.Abort(OutcomeQuit)
+			return vs.exit()
+		}
+		return vs
+	}
+
+	gs := vs.game
+	if vs.paused {
+		gs.clock.Reset()
+		vs.paused = false
+	}
+	switch next := gs.Update().(type) {
+	case *GameScene:
+		return vs
+	case *GameOverScene, *StageClearScene:
+		scores := vs.roundScores()
+		vs.scores[0] += scores[0]
+		vs.scores[1] += scores[1]
+		vs.round++
+		if vs.round >= VersusRounds {
+			vs.finished = true
+		} else {
+			vs.startRound()
+		}
+	default:
+		return next
+	}
+	return vs
+}
+
+func (vs *VersusScene) Draw(screen *ebiten.Image) {
+	vs.game.Draw(screen)
+
+	screenWidth, screenHeight := ScreenSize()
+	centerX := float32(screenWidth) / 2
+	centerY := float32(screenHeight) / 2
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	switch {
+	case vs.finished:
+		result := "DRAW"
+		if vs.scores[0] != vs.scores[1] {
+			winner := 0
+			if vs.scores[1] > vs.scores[0] {
+				winner = 1
+			}
+			result = fmt.Sprintf("%dUP WINS!", winner+1)
+		}
+		vector.DrawFilledRect(screen, 0, centerY-30, float32(screenWidth), 60, color.RGBA{A: 200}, false)
+		drawTextCentered(screen, result, centerX, centerY-20, 4, PlayerColor)
+		drawTextCentered(screen, "PRESS ENTER", centerX, centerY+12, 2, white)
+	case time.Now().Before(vs.readyUntil):
+		vector.DrawFilledRect(screen, 0, centerY-30, float32(screenWidth), 60, color.RGBA{A: 200}, false)
+		drawTextCentered(screen, fmt.Sprintf("ROUND %d", vs.round+1), centerX, centerY-20, 4, ghostColors[2])
+		roles := fmt.Sprintf("%dUP: PLAYER   %dUP: GHOST", vs.pac()+1, 2-vs.pac())
+		drawTextCentered(screen, roles, centerX, centerY+12, 2, white)
+	}
+}
+
+// drawHUD は2人の合計点と、いまの役を表示する。
+func (vs *VersusScene) drawHUD(screen *ebiten.Image) {
+	screenWidth, _ := ScreenSize()
+	columnWidth := float32(screenWidth) / 2
+	round := vs.roundScores()
+	for i := 0; i < 2; i++ {
+		x := 10 + columnWidth*float32(i)
+		role, clr := "GHOST", ghostColors[0]
+		if i == vs.pac() {
+			role, clr = "PLAYER", PlayerColor
+		}
+		drawText(screen, fmt.Sprintf("%dUP %d", i+1, vs.scores[i]+round[i]), x, 10, 2, clr)
+		drawText(screen, role, x, 26, 2, clr)
+	}
+	x := 10 + columnWidth*float32(vs.pac())
+	for life := 0; life < vs.game.players[0].Lives; life++ {
+		vector.DrawFilledCircle(screen, x+5+float32(life)*14, 48, 5, PlayerColor, true)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	wallStrokeWidth = 2
+	// 二重線の内側・外側それぞれの、壁タイルの縁からの距離
+	wallInnerInset = float32(TileSize) / 6
+	wallOuterInset = float32(TileSize) / 3
+)
+
+var (
+	DoorColor = color.RGBA{R: 255, G: 184, B: 222, A: 255}
+
+	// レベルごとの壁の色。レベル数が超えたら先頭から繰り返す
+	LevelWallColors = []color.RGBA{
+		{R: 33, G: 33, B: 255, A: 255},
+		{R: 255, G: 120, B: 40, A: 255},
+		{R: 0, G: 200, B: 120, A: 255},
+		{R: 200, G: 60, B: 200, A: 255},
+	}
+)
+
+func WallColorForLevel(level int) color.RGBA {
+	if level < 1 {
+		level = 1
+	}
+	return LevelWallColors[(level-1)%len(LevelWallColors)]
+}
+
+func isWallAt(maze [][]int, x, y int) bool {
+	// 迷路の外側は壁とみなし、外周に余計な線を引かない
+	if y < 0 || y >= len(maze) || x < 0 || x >= len(maze[0]) {
+		return true
+	}
+	return maze[y][x] == TileWall
+}
+
+// drawWalls は各壁タイルの隣接タイルを調べ、通路に面した辺に沿って二重の輪郭線を描く。
+// 外向きの角 (凸) と内向きの角 (凹) はどちらも円弧でつなぐ。
+func drawWalls(dst *ebiten.Image, maze [][]int, clr color.Color) {
+	op := &vector.StrokeOptions{Width: wallStrokeWidth}
+	var vertices []ebiten.Vertex
+	var indices []uint16
+	for y, row := range maze {
+		var path vector.Path
+		for x, tile := range row {
+			if tile != TileWall {
+				continue
+			}
+			for _, inset := range []float32{wallInnerInset, wallOuterInset} {
+				appendWallOutline(&path, maze, x, y, inset)
+			}
+		}
+		vertices, indices = path.AppendVerticesAndIndicesForStroke(vertices, indices, op)
+		// 大きな迷路でインデックスが uint16 に収まらなくならないよう、行単位で区切って描く
+		if len(vertices) > maxBatchVertices/2 {
+			drawSolidTriangles(dst, vertices, indices, clr)
+			vertices, indices = vertices[:0], indices[:0]
+		}
+	}
+	if len(vertices) > 0 {
+		drawSolidTriangles(dst, vertices, indices, clr)
+	}
+
+	for y, row := range maze {
+		for x, tile := range row {
+			if tile == TileDoor {
+				drawDoor(dst, maze, x, y)
+			}
+		}
+	}
+}
+
+func appendWallOutline(path *vector.Path, maze [][]int, x, y int, inset float32) {
+	left := float32(x * TileSize)
+	top := float32(y * TileSize)
+	right := left + TileSize
+	bottom := top + TileSize
+	half := float32(TileSize) / 2
+	radius := half - inset
+
+	up := !isWallAt(maze, x, y-1)
+	down := !isWallAt(maze, x, y+1)
+	leftOpen := !isWallAt(maze, x-1, y)
+	rightOpen := !isWallAt(maze, x+1, y)
+
+	// 辺: 通路に面した辺に平行な線。隣の辺も開いていれば角の円弧の手前で止める
+	if up {
+		x0, x1 := left, right
+		if leftOpen {
+			x0 = left + half
+		}
+		if rightOpen {
+			x1 = right - half
+		}
+		strokeSegment(path, x0, top+inset, x1, top+inset)
+	}
+	if down {
+		x0, x1 := left, right
+		if leftOpen {
+			x0 = left + half
+		}
+		if rightOpen {
+			x1 = right - half
+		}
+		strokeSegment(path, x0, bottom-inset, x1, bottom-inset)
+	}
+	if leftOpen {
+		y0, y1 := top, bottom
+		if up {
+			y0 = top + half
+		}
+		if down {
+			y1 = bottom - half
+		}
+		strokeSegment(path, left+inset, y0, left+inset, y1)
+	}
+	if rightOpen {
+		y0, y1 := top, bottom
+		if up {
+			y0 = top + half
+		}
+		if down {
+			y1 = bottom - half
+		}
+		strokeSegment(path, right-inset, y0, right-inset, y1)
+	}
+
+	// 凸の角: タイル中心を中心とする円弧
+	centerX := left + half
+	centerY := top + half
+	if up && leftOpen {
+		strokeArc(path, centerX, centerY, radius, math.Pi, 3*math.Pi/2)
+	}
+	if up && rightOpen {
+		strokeArc(path, centerX, centerY, radius, 3*math.Pi/2, 2*math.Pi)
+	}
+	if down && rightOpen {
+		strokeArc(path, centerX, centerY, radius, 0, math.Pi/2)
+	}
+	if down && leftOpen {
+		strokeArc(path, centerX, centerY, radius, math.Pi/2, math.Pi)
+	}
+
+	// 凹の角: 上下左右は壁で斜めだけが通路のとき、タイルの角を中心とする円弧
+	if !up && !leftOpen && !isWallAt(maze, x-1, y-1) {
+		strokeArc(path, left, top, inset, 0, math.Pi/2)
+	}
+	if !up && !rightOpen && !isWallAt(maze, x+1, y-1) {
+		strokeArc(path, right, top, inset, math.Pi/2, math.Pi)
+	}
+	if !down && !rightOpen && !isWallAt(maze, x+1, y+1) {
+		strokeArc(path, right, bottom, inset, math.Pi, 3*math.Pi/2)
+	}
+	if !down && !leftOpen && !isWallAt(maze, x-1, y+1) {
+		strokeArc(path, left, bottom, inset, 3*math.Pi/2, 2*math.Pi)
+	}
+}
+
+func strokeSegment(path *vector.Path, x0, y0, x1, y1 float32) {
+	if x0 == x1 && y0 == y1 {
+		return
+	}
+	path.MoveTo(x0, y0)
+	path.LineTo(x1, y1)
+}
+
+func strokeArc(path *vector.Path, cx, cy, radius, startAngle, endAngle float32) {
+	path.MoveTo(cx+radius*float32(math.Cos(float64(startAngle))), cy+radius*float32(math.Sin(float64(startAngle))))
+	path.Arc(cx, cy, radius, startAngle, endAngle, vector.Clockwise)
+}
+
+// drawDoor はゴーストの巣の扉をピンクの細い棒として描く。両脇の壁の向きに合わせて横向きか縦向きにする。
+func drawDoor(dst *ebiten.Image, maze [][]int, x, y int) {
+	left := float32(x * TileSize)
+	top := float32(y * TileSize)
+	thickness := float32(TileSize) / 6
+	if isWallAt(maze, x, y-1) && isWallAt(maze, x, y+1) && !isWallAt(maze, x-1, y) {
+		vector.DrawFilledRect(dst, left+(TileSize-thickness)/2, top, thickness, TileSize, DoorColor, false)
+		return
+	}
+	vector.DrawFilledRect(dst, left, top+(TileSize-thickness)/2, TileSize, thickness, DoorColor, false)
+}
+
+func drawSolidTriangles(dst *ebiten.Image, vertices []ebiten.Vertex, indices []uint16, clr color.Color) {
+	r, g, b, a := clr.RGBA()
+	for i := range vertices {
+		vertices[i].SrcX = 1
+		vertices[i].SrcY = 1
+		vertices[i].ColorR = float32(r) / 0xffff
+		vertices[i].ColorG = float32(g) / 0xffff
+		vertices[i].ColorB = float32(b) / 0xffff
+		vertices[i].ColorA = float32(a) / 0xffff
+	}
+	op := &ebiten.DrawTrianglesOptions{}
+	op.ColorScaleMode = ebiten.ColorScaleModePremultipliedAlpha
+	op.FillRule = ebiten.FillRuleNonZero
+	op.AntiAlias = true
+	dst.DrawTriangles(vertices, indices, solidSubImage(), op)
+}